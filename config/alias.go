@@ -0,0 +1,44 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+type alias struct {
+	old string
+	new string
+}
+
+// aliases maps the deprecated keys to the new keys and warns once per source.
+type aliases struct {
+	keys   []alias
+	warned sync.Map
+}
+
+// apply moves the values of the deprecated keys in the settings of the source to the new keys.
+// The new key wins if the source sets both keys.
+func (a *aliases) apply(source string, settings map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	for _, k := range a.keys {
+		val, ok := getPath(settings, k.old)
+		if !ok {
+			continue
+		}
+		deletePath(settings, k.old)
+		if _, exists := getPath(settings, k.new); !exists {
+			setPath(settings, k.new, val)
+		}
+
+		if _, warned := a.warned.LoadOrStore(source+"\x00"+k.old, struct{}{}); !warned {
+			log.Warn().
+				Str("source", source).
+				Str("key", k.old).
+				Str("replacement", k.new).
+				Msg("Config key is deprecated")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAlias(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() {
+		log.Logger = logger
+	}()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("db:\n  addr: old\n  port: 1\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("db:\n  addr: ignored\ndatabase:\n  host: new\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.yaml"), []byte("other: 1\n"), 0o600))
+
+	conf, err := Init(
+		WithBatchFiles(BatchFileOption{Directory: dir}),
+		WithAlias("db.addr", "database.host"),
+		WithAlias("DB.Port", "database.port"),
+	)
+	require.NoError(t, err)
+	require.NoError(t, conf.Reload())
+
+	v := conf.(*config).current()
+	require.Equal(t, "new", v.GetString("database.host"))
+	require.Equal(t, 1, v.GetInt("database.port"))
+	require.False(t, v.IsSet("db.addr"))
+	require.False(t, v.IsSet("db.port"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3, "warn once per source and key")
+	require.Contains(t, lines[0], filepath.Join(dir, "a.yaml"))
+	require.Contains(t, buf.String(), `"key":"db.addr","replacement":"database.host"`)
+	require.NotContains(t, buf.String(), "c.yaml")
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Operations of the audit changes.
+const (
+	AuditAdd    = "add"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// masked replaces the secret values in the audit events.
+const masked = "****"
+
+// AuditChange is a key-level change of the effective config.
+type AuditChange struct {
+	Tenant string      `json:"tenant,omitempty"` // the tenant of the overlay, empty for the base config.
+	Key    string      `json:"key"`
+	Op     string      `json:"op"` // add/update/delete
+	Old    interface{} `json:"old,omitempty"`
+	New    interface{} `json:"new,omitempty"`
+}
+
+// AuditEvent is the changes of the effective config by a reload.
+type AuditEvent struct {
+	Time    time.Time     `json:"time"`
+	Changes []AuditChange `json:"changes"`
+}
+
+// AuditSink receives the audit events.
+type AuditSink interface {
+	Emit(event AuditEvent)
+}
+
+// AuditSinkFunc is a function implementing AuditSink.
+type AuditSinkFunc func(event AuditEvent)
+
+func (f AuditSinkFunc) Emit(event AuditEvent) {
+	f(event)
+}
+
+// LogSink logs the audit events through the global zerolog logger set by `exlog.Init`.
+type LogSink struct{}
+
+func (LogSink) Emit(event AuditEvent) {
+	log.Info().
+		Time("changed_at", event.Time).
+		Interface("changes", event.Changes).
+		Msg("Config changed")
+}
+
+// defaultSecretKeys are the default key patterns of the secret values.
+var defaultSecretKeys = []string{"password", "passwd", "secret", "token", "credential", "private_key", "api_key", "apikey"}
+
+type auditor struct {
+	sink       AuditSink
+	secretKeys []string
+}
+
+// secret reports whether the key contains any secret pattern.
+func (a *auditor) secret(key string) bool {
+	for _, pattern := range a.secretKeys {
+		if strings.Contains(key, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// record emits the changes between the snapshots.
+// The changes of a tenant are the ones of its merged config, except the ones inherited from the base config.
+func (a *auditor) record(prev, next *snapshot) {
+	changes := a.diff("", prev.v.AllSettings(), next.v.AllSettings())
+	inherited := make(map[string]AuditChange, len(changes))
+	for _, change := range changes {
+		inherited[change.Key] = change
+	}
+
+	tenants := make(map[string]struct{})
+	for id := range prev.tenants {
+		tenants[id] = struct{}{}
+	}
+	for id := range next.tenants {
+		tenants[id] = struct{}{}
+	}
+	ids := make([]string, 0, len(tenants))
+	for id := range tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, change := range a.diff(id, prev.view(id).AllSettings(), next.view(id).AllSettings()) {
+			base, ok := inherited[change.Key]
+			if ok && base.Op == change.Op && reflect.DeepEqual(base.Old, change.Old) && reflect.DeepEqual(base.New, change.New) {
+				continue
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+	a.sink.Emit(AuditEvent{
+		Time:    time.Now(),
+		Changes: changes,
+	})
+}
+
+// diff returns the key-level changes between the settings ordered by key.
+func (a *auditor) diff(tenant string, prev, next map[string]interface{}) []AuditChange {
+	oldKeys, newKeys := flatten(prev), flatten(next)
+	keys := make([]string, 0, len(oldKeys)+len(newKeys))
+	for k := range oldKeys {
+		keys = append(keys, k)
+	}
+	for k := range newKeys {
+		if _, ok := oldKeys[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []AuditChange
+	for _, k := range keys {
+		oldVal, hasOld := oldKeys[k]
+		newVal, hasNew := newKeys[k]
+		change := AuditChange{
+			Tenant: tenant,
+			Key:    k,
+			Old:    oldVal,
+			New:    newVal,
+		}
+		switch {
+		case !hasOld:
+			change.Op = AuditAdd
+		case !hasNew:
+			change.Op = AuditDelete
+		case !reflect.DeepEqual(oldVal, newVal):
+			change.Op = AuditUpdate
+		default:
+			continue
+		}
+		if hasOld {
+			change.Old = a.mask(k, oldVal)
+		}
+		if hasNew {
+			change.New = a.mask(k, newVal)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// mask returns the value of the key with the secret values masked,
+// including the ones nested in the maps and lists.
+func (a *auditor) mask(key string, v interface{}) interface{} {
+	if a.secret(key) {
+		return masked
+	}
+	if m, ok := toMap(v); ok {
+		out := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			out[k] = a.mask(key+"."+strings.ToLower(k), val)
+		}
+		return out
+	}
+	if items, ok := v.([]interface{}); ok {
+		out := make([]interface{}, len(items))
+		for i := range items {
+			out[i] = a.mask(key, items[i])
+		}
+		return out
+	}
+	return v
+}
+
+// flatten returns the leaf values of the nested settings by dotted keys.
+func flatten(settings map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+				walk(k, nested)
+				continue
+			}
+			out[k] = v
+		}
+	}
+	walk("", settings)
+	return out
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAudit(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(fn, []byte("db:\n  host: a\n  password: p1\n  port: 1\nname: svc\n"+
+		"replicas:\n  - {host: r1, password: p1}\n"), 0o600))
+	tenants := t.TempDir()
+	overlay := filepath.Join(tenants, "acme", "config.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(overlay), 0o755))
+	require.NoError(t, os.WriteFile(overlay, []byte("db:\n  host: b\n"), 0o600))
+
+	var events []AuditEvent
+	conf, err := Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithTenantFiles(TenantFileOption{Directory: tenants}),
+		WithAudit(AuditOption{
+			Sink: AuditSinkFunc(func(event AuditEvent) {
+				events = append(events, event)
+			}),
+		}),
+	)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	require.NoError(t, conf.Reload())
+	require.Empty(t, events, "no change")
+
+	require.NoError(t, os.WriteFile(fn, []byte("db:\n  host: a\n  password: p2\n  user: u\nname: api\n"+
+		"replicas:\n  - {host: r1, password: p2}\n"), 0o600))
+	require.NoError(t, os.WriteFile(overlay, []byte("db:\n  host: c\n  port: $delete\n$merge: {tags: append}\ntags: [t1]\n"), 0o600))
+	require.NoError(t, conf.Reload())
+	require.Len(t, events, 1)
+	require.Equal(t, []AuditChange{
+		{Key: "db.password", Op: AuditUpdate, Old: "****", New: "****"},
+		{Key: "db.port", Op: AuditDelete, Old: 1},
+		{Key: "db.user", Op: AuditAdd, New: "u"},
+		{Key: "name", Op: AuditUpdate, Old: "svc", New: "api"},
+		{
+			Key: "replicas", Op: AuditUpdate,
+			Old: []interface{}{map[string]interface{}{"host": "r1", "password": "****"}},
+			New: []interface{}{map[string]interface{}{"host": "r1", "password": "****"}},
+		},
+		{Tenant: "acme", Key: "db.host", Op: AuditUpdate, Old: "b", New: "c"},
+		{Tenant: "acme", Key: "tags", Op: AuditAdd, New: []interface{}{"t1"}},
+	}, events[0].Changes)
+
+	require.NoError(t, os.WriteFile(overlay, []byte("db:\n  host: c\n  user: $delete\n$merge: {tags: append}\ntags: [t1]\n"), 0o600))
+	require.NoError(t, conf.Reload())
+	require.Len(t, events, 2)
+	require.Equal(t, []AuditChange{
+		{Tenant: "acme", Key: "db.user", Op: AuditDelete, Old: "u"},
+	}, events[1].Changes, "tombstone of the tenant overlay")
+
+	require.NoError(t, os.RemoveAll(filepath.Dir(overlay)))
+	require.NoError(t, conf.Reload())
+	require.Len(t, events, 3)
+	require.Equal(t, []AuditChange{
+		{Tenant: "acme", Key: "db.host", Op: AuditUpdate, Old: "c", New: "a"},
+		{Tenant: "acme", Key: "db.user", Op: AuditAdd, New: "u"},
+		{Tenant: "acme", Key: "tags", Op: AuditDelete, Old: []interface{}{"t1"}},
+	}, events[2].Changes, "removed tenant falls back to the base config")
+}
+
+func TestLogSink(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() {
+		log.Logger = logger
+	}()
+
+	LogSink{}.Emit(AuditEvent{
+		Changes: []AuditChange{
+			{Key: "name", Op: AuditUpdate, Old: "svc", New: "api"},
+		},
+	})
+	require.Contains(t, buf.String(), `"changes":[{"key":"name","op":"update","old":"svc","new":"api"}]`)
+}
@@ -1,25 +1,76 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"sync"
 
 	"github.com/ipfans/saaslib/liberrors"
 	"github.com/morikuni/failure"
 	"github.com/spf13/viper"
-	_ "github.com/spf13/viper/remote"
 )
 
 type Config interface {
 	Unmarshal(interface{}) error
+	// UnmarshalKey decodes the settings under key into v.
+	UnmarshalKey(key string, v interface{}) error
+	// Get returns a copy of the value of key, or nil if the key does not exist.
+	Get(key string) interface{}
+	// Tenant returns the config merged with the overlay of the tenant in ctx.
+	Tenant(ctx context.Context) Config
+	// Reload reads all sources again, validates and swaps the merged config.
+	// The current config is kept if any source or validator fails.
+	Reload() error
+	// OnChange registers fn to be called after every successful reload.
+	OnChange(fn func())
+	// Usage returns the access of the keys since Init if WithAccessTracking is set.
+	Usage() UsageReport
+	// Snapshot returns the immutable view of the current config, which is not changed by reloads.
+	Snapshot() Snapshot
+	// Sources returns the provenance of the sources merged by the last load, in merge order.
+	Sources() []SourceInfo
+	// Close stops watching the sources.
+	Close() error
 }
 
 type config struct {
+	*store
+
+	tenant string
+}
+
+// store holds the latest snapshot shared by the config and its tenant views.
+type store struct {
+	o option
+
+	reloadMu sync.Mutex // serializes the reloads.
+
+	mu          sync.RWMutex
+	snap        *snapshot
+	subscribers []func()
+
+	cancel   context.CancelFunc
+	debounce *debouncer
+	access   *accessTracker
+}
+
+// snapshot is the result of reading and merging all sources once.
+type snapshot struct {
 	local  *viper.Viper
 	remote *viper.Viper
 
 	v *viper.Viper
+
+	sources []SourceInfo
+
+	overlays map[string][]map[string]interface{}
+	tenants  map[string]*viper.Viper
+
+	version uint64 // assigned when the snapshot is used, starting at 1.
+	hash    string
 }
 
 // Init returns a new config instance.
@@ -28,156 +79,336 @@ type config struct {
 // nolint:nakedret
 func Init(opt ...Option) (conf Config, err error) {
 	var o option
-	c := &config{
-		local:  viper.New(),
-		remote: viper.New(),
-
-		v: viper.New(),
-	}
-
 	if len(opt) == 0 {
 		opt = append(opt, WithLocalFile(LocalOption{}))
 	}
 	for i := range opt {
 		opt[i](&o)
 	}
+	if !o.enabled() {
+		err = failure.New(liberrors.ErrConfigNotEnabled, failure.Message("No config source is enabled"))
+		return
+	}
+	for key, st := range o.strategies {
+		if err = st.check(); err != nil {
+			err = failure.Wrap(err, failure.Context{"key": key})
+			return
+		}
+	}
+
+	s, err := load(o)
+	if err != nil {
+		return
+	}
+	if err = o.validate(s); err != nil {
+		return
+	}
+
+	s.version = 1
+	c := &config{
+		store: &store{
+			o:    o,
+			snap: s,
+		},
+	}
+	if o.reloadQuiet > 0 {
+		c.debounce = &debouncer{
+			quiet:   o.reloadQuiet,
+			maxWait: o.reloadMaxWait,
+		}
+		if c.debounce.maxWait <= 0 {
+			c.debounce.maxWait = 10 * o.reloadQuiet
+		}
+	}
+	if o.accessTracking {
+		c.access = &accessTracker{reads: make(map[string]uint64)}
+	}
+	if err = c.watch(); err != nil {
+		return
+	}
+
+	conf = c
+	if o.asDefault {
+		SetDefault(conf)
+	}
+	return
+}
+
+// load reads and merges all enabled sources.
+// The errors without code are ErrConfigReadFailed.
+// nolint:nakedret
+func load(o option) (s *snapshot, err error) {
+	s = &snapshot{
+		local:  viper.New(),
+		remote: viper.New(),
+
+		v: viper.New(),
+	}
 
 	defer func() {
 		if err != nil {
-			err = failure.Wrap(err, failure.WithCode(liberrors.ErrConfigReadFailed))
+			s = nil
+			if _, ok := failure.CodeOf(err); !ok {
+				err = failure.Wrap(err, failure.WithCode(liberrors.ErrConfigReadFailed))
+			}
 		}
 	}()
 
-	if o.localEnable {
-		if err = c.readLocalConfig(o); err != nil {
+	if len(o.locals) > 0 {
+		if err = s.readLocalConfig(o); err != nil {
 			return
 		}
 	}
 
 	if o.remoteEnable {
-		if err = c.readRemoteConfig(o); err != nil {
+		if err = s.readRemoteConfig(o); err != nil {
 			return
 		}
 	}
 
-	err = c.mergeConfig(o)
+	if err = s.mergeConfig(o); err != nil {
+		return
+	}
 
-	conf = c
+	if err = s.mergeSources(context.Background(), o); err != nil {
+		return
+	}
+
+	if o.envEnable {
+		if err = s.mergeEnv(o); err != nil {
+			return
+		}
+	}
+
+	if err = s.mergeFlags(o); err != nil {
+		return
+	}
+
+	if o.tenantLocalEnable {
+		if err = s.readTenantFiles(o); err != nil {
+			return
+		}
+	}
+
+	if o.tenantRemoteEnable {
+		if err = s.readTenantRemote(o); err != nil {
+			return
+		}
+	}
+
+	if len(o.migrations) > 0 {
+		if err = s.migrate(o); err != nil {
+			return
+		}
+	}
+
+	if err = s.mergeTenants(o); err != nil {
+		return
+	}
+	s.hash = s.contentHash()
 	return
 }
 
-func (c *config) readSingleFile(o option) (err error) {
-	if err = c.local.ReadInConfig(); err != nil {
-		err = failure.Wrap(err,
-			failure.Context{"config": filepath.Join(o.localDir, o.localName+"."+o.localType)},
-		)
+func (s *snapshot) readSingleFile(o option, f localFile) (err error) {
+	path, format, err := findFile(f.dir, f.name, f.ftype)
+	if err != nil {
+		if f.optional && failure.Is(err, liberrors.ErrConfigFileNotFound) {
+			s.skip(path)
+			err = nil
+		}
+		return
+	}
+	settings, err := readFile(path, format, o.verifier)
+	if err != nil {
 		return
 	}
+	o.aliases.apply(path, settings)
+	if settings, err = o.selectSettings(settings, failure.Context{"config": path}); err != nil {
+		return
+	}
+	if s.local, err = o.merge(s.local, settings, failure.Context{"config": path}); err != nil {
+		return
+	}
+	s.record(SourceInfo{Name: path, Optional: f.optional})
 	return
 }
 
-//nolint:nilerr
-func (c *config) batchFiles(o option) error {
-	err := filepath.Walk(o.localDir, func(path string, info os.FileInfo, err error) (e error) {
-		if info.IsDir() || err != nil {
+// batchFiles reads every file of the supported types in the directory.
+// The type of a file is inferred from its extension.
+func (s *snapshot) batchFiles(o option, f localFile) error {
+	err := filepath.Walk(f.dir, func(path string, info os.FileInfo, err error) (e error) {
+		if err != nil {
+			if f.optional && path == f.dir && errors.Is(err, os.ErrNotExist) {
+				s.skip(path)
+				return filepath.SkipDir
+			}
+			return fileError(err, path)
+		}
+		if info.IsDir() {
 			return
 		}
-		fn := strings.Split(filepath.Base(path), ".")[0]
-		if fn == "" {
+		format, ok := formatOf(path)
+		if !ok || (f.ftype != "" && format != formats[f.ftype]) {
 			return
 		}
 
-		v := viper.New()
-		v.AddConfigPath(o.localDir)
-		v.SetConfigName(fn)
-		v.SetConfigType(o.localType)
-		if e = v.ReadInConfig(); e != nil {
-			e = failure.Wrap(e,
-				failure.Context{
-					"config": filepath.Join(o.localDir, fn+"."+o.localType),
-				},
-			)
+		settings, e := readFile(path, format, o.verifier)
+		if e != nil {
+			return
+		}
+		o.aliases.apply(path, settings)
+		if settings, e = o.selectSettings(settings, failure.Context{"config": path}); e != nil {
 			return
 		}
-		e = c.v.MergeConfigMap(v.AllSettings())
-		e = failure.Wrap(e,
-			failure.Message("Merge config failed"),
-			failure.Context{
-				"config": filepath.Join(o.localDir, fn+"."+o.localType),
-			},
-		)
+		if s.local, e = o.merge(s.local, settings, failure.Context{"config": path}); e != nil {
+			return
+		}
+		s.record(SourceInfo{Name: path, Optional: f.optional})
 		return
 	})
 	return err
 }
 
-func (c *config) readLocalConfig(o option) (err error) {
-	c.local = viper.New()
-	c.local.AddConfigPath(o.localDir)
-	c.local.SetConfigType(o.localType)
+// readLocalConfig reads the local files and batch directories in order.
+func (s *snapshot) readLocalConfig(o option) (err error) {
+	s.local = viper.New()
 
-	if o.localName != "" {
-		c.local.SetConfigName(o.localName)
-		err = c.readSingleFile(o)
-		return
-	} else {
-		err = c.batchFiles(o)
+	for _, f := range o.locals {
+		if f.name != "" {
+			err = s.readSingleFile(o, f)
+		} else {
+			err = s.batchFiles(o, f)
+		}
+		if err != nil {
+			return
+		}
 	}
-
 	return
 }
 
-func (c *config) readRemoteConfig(o option) (err error) {
-	if err = c.remote.AddRemoteProvider(o.remoteDriver, o.remoteEndpoint, o.remotePath); err != nil {
-		err = failure.Wrap(err,
-			failure.Context{
-				"driver":   o.remoteDriver,
-				"endpoint": o.remoteEndpoint,
-				"path":     o.remotePath,
-			},
-		)
-		return
+// readRemoteConfig reads the consul key.
+func (s *snapshot) readRemoteConfig(o option) error {
+	fctx := failure.Context{
+		"driver":   o.remoteDriver,
+		"endpoint": o.remoteEndpoint,
+		"path":     o.remotePath,
 	}
-	c.remote.SetConfigType(o.remoteType)
-	if err = c.remote.ReadRemoteConfig(); err != nil {
-		err = failure.Wrap(err,
-			failure.Context{
-				"driver":   o.remoteDriver,
-				"endpoint": o.remoteEndpoint,
-				"path":     o.remotePath,
-			},
-		)
-		return
+	client, err := consulClient(o.remoteEndpoint)
+	if err != nil {
+		return err
 	}
-	return
+	pair, _, err := client.KV().Get(o.remotePath, nil)
+	if err != nil {
+		return failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, fctx)
+	}
+	if pair == nil {
+		if o.remoteOptional {
+			s.skip(o.remoteSource())
+			return nil
+		}
+		return failure.New(liberrors.ErrConfigKeyNotFound, fctx)
+	}
+	if err = o.verifyRemote(client, o.remoteSource(), o.remotePath, pair.Value); err != nil {
+		return err
+	}
+	settings, err := decode(pair.Value, o.remoteType, o.remoteSource())
+	if err != nil {
+		return err
+	}
+	o.aliases.apply(o.remoteSource(), settings)
+	if settings, err = o.selectSettings(settings, fctx); err != nil {
+		return err
+	}
+	// the directives and tombstones are kept until merged with the local config.
+	s.remote = viper.New()
+	if err = s.remote.MergeConfigMap(settings); err != nil {
+		return failure.Wrap(err, fctx)
+	}
+	s.record(SourceInfo{
+		Name:     o.remoteSource(),
+		Optional: o.remoteOptional,
+		Metadata: map[string]string{"index": strconv.FormatUint(pair.ModifyIndex, 10)},
+	})
+	return nil
 }
 
-func (c *config) mergeConfig(o option) (err error) {
-	if o.localEnable {
-		if err = c.v.MergeConfigMap(c.local.AllSettings()); err != nil {
-			err = failure.Wrap(err,
-				failure.Context{
-					"config": filepath.Join(o.localDir, o.localName+"."+o.localType),
-				},
-			)
+func (s *snapshot) mergeConfig(o option) (err error) {
+	if len(o.locals) > 0 {
+		if s.v, err = o.merge(s.v, s.local.AllSettings(), failure.Context{"config": "local"}); err != nil {
 			return
 		}
 	}
 	if o.remoteEnable {
-		if err = c.v.MergeConfigMap(c.remote.AllSettings()); err != nil {
-			err = failure.Wrap(err,
-				failure.Context{
-					"driver":   o.remoteDriver,
-					"endpoint": o.remoteEndpoint,
-					"path":     o.remotePath,
-				},
-			)
+		if s.v, err = o.merge(s.v, s.remote.AllSettings(), failure.Context{"config": o.remoteSource()}); err != nil {
 			return
 		}
 	}
 	return
 }
 
+// current returns the merged settings of the view.
+func (c *config) current() *viper.Viper {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.snap.view(c.tenant)
+}
+
 func (c *config) Unmarshal(v interface{}) error {
-	return c.v.Unmarshal(v)
+	c.access.read("", v)
+	return unmarshalCopy(c.current(), "", v)
+}
+
+func (c *config) UnmarshalKey(key string, v interface{}) error {
+	c.access.read(key, v)
+	return unmarshalCopy(c.current(), key, v)
+}
+
+func (c *config) Get(key string) interface{} {
+	c.access.read(key, nil)
+	return deepCopy(c.current().Get(key))
+}
+
+func (c *config) Reload() error {
+	subscribers, err := c.swap()
+	if err != nil {
+		return err
+	}
+	for _, fn := range subscribers {
+		fn()
+	}
+	return nil
+}
+
+// swap loads, validates and swaps the snapshot, and returns the subscribers to notify.
+// The reloads are serialized, so a slower load never replaces the snapshot of a later one.
+func (c *config) swap() ([]func(), error) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	s, err := load(c.o)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.o.validate(s); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	prev := c.snap
+	s.version = prev.version + 1
+	c.snap = s
+	subscribers := make([]func(), len(c.subscribers))
+	copy(subscribers, c.subscribers)
+	c.mu.Unlock()
+
+	if c.o.audit != nil {
+		c.o.audit.record(prev, s)
+	}
+	return subscribers, nil
+}
+
+func (c *config) OnChange(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, fn)
 }
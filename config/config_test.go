@@ -1,8 +1,11 @@
 package config
 
 import (
+	"context"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul/sdk/testutil"
 	"github.com/stretchr/testify/require"
@@ -160,7 +163,7 @@ func TestInit(t *testing.T) {
 			gotConf, err := Init(tt.args.opt...)
 			tt.assertion(t, err)
 			for i := range tt.wantConf {
-				require.Equal(t, tt.wantConf[i].value, gotConf.(*config).v.GetString(tt.wantConf[i].key))
+				require.Equal(t, tt.wantConf[i].value, gotConf.(*config).current().GetString(tt.wantConf[i].key))
 			}
 		})
 	}
@@ -208,3 +211,81 @@ func Test_Unmarshal(t *testing.T) {
 	require.Equal(t, "2", c.A.B.C)
 	require.Equal(t, "2", c.A.B.D)
 }
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	fn := dir + "/config.yaml"
+	require.NoError(t, os.WriteFile(fn, []byte("a:\n  b:\n    c: \"1\"\n"), 0o600))
+
+	conf, err := Init(WithLocalFile(LocalOption{Directory: dir}))
+	require.NoError(t, err)
+
+	var changed int
+	conf.OnChange(func() {
+		changed++
+	})
+
+	require.NoError(t, os.WriteFile(fn, []byte("a:\n  b:\n    c: \"2\"\n"), 0o600))
+	require.NoError(t, conf.Reload())
+	require.Equal(t, 1, changed)
+	require.Equal(t, "2", conf.(*config).current().GetString("a.b.c"))
+
+	require.NoError(t, os.Remove(fn))
+	require.Error(t, conf.Reload())
+	require.Equal(t, 1, changed)
+	require.Equal(t, "2", conf.(*config).current().GetString("a.b.c"))
+}
+
+// blockingSource returns the number of its loads, and blocks the load of number block until released.
+type blockingSource struct {
+	mu      sync.Mutex
+	loads   int
+	block   int
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSource) Name() string {
+	return "blocking"
+}
+
+func (s *blockingSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	s.mu.Lock()
+	s.loads++
+	n := s.loads
+	s.mu.Unlock()
+	if n == s.block {
+		close(s.entered)
+		<-s.release
+	}
+	return map[string]interface{}{"n": n}, nil
+}
+
+func (s *blockingSource) Watch(ctx context.Context, notify func()) error {
+	return nil
+}
+
+func TestReload_Serialized(t *testing.T) {
+	src := &blockingSource{
+		block:   2,
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	conf, err := Init(WithSource(src))
+	require.NoError(t, err)
+	require.Equal(t, 1, conf.Get("n"))
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- conf.Reload()
+	}()
+	<-src.entered
+	go func() {
+		errs <- conf.Reload()
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(src.release)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	require.Equal(t, 3, conf.Get("n"), "the slower reload does not replace the later one")
+}
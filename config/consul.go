@@ -0,0 +1,35 @@
+package config
+
+import (
+	"github.com/hashicorp/consul/api"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+)
+
+// consulClient returns the consul client of the endpoint.
+func consulClient(endpoint string) (client *api.Client, err error) {
+	if client, err = api.NewClient(&api.Config{Address: endpoint}); err != nil {
+		err = failure.Wrap(err, failure.Context{"endpoint": endpoint})
+	}
+	return
+}
+
+// verifyRemote verifies the value of the consul key read as the source against the signature key.
+func (o option) verifyRemote(client *api.Client, source, key string, value []byte) (err error) {
+	if o.verifier == nil {
+		return
+	}
+	sigKey := key + o.verifier.suffix
+	fctx := failure.Context{"key": key, "signature": sigKey}
+	pair, _, err := client.KV().Get(sigKey, nil)
+	if err != nil {
+		err = failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, fctx)
+		return
+	}
+	if pair == nil {
+		err = failure.New(liberrors.ErrConfigSignatureInvalid, failure.Message("Signature not found"), fctx)
+		return
+	}
+	err = o.verifier.verify(source, value, pair.Value)
+	return
+}
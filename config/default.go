@@ -0,0 +1,52 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+)
+
+var (
+	defaultMu   sync.RWMutex
+	defaultConf Config
+)
+
+// Default returns the process-wide config set by Init with AsDefault or by SetDefault.
+// It returns nil if no default config is set.
+func Default() Config {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultConf
+}
+
+// SetDefault sets the process-wide config.
+func SetDefault(conf Config) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultConf = conf
+}
+
+// ResetDefault clears the process-wide config. It is intended for tests.
+func ResetDefault() {
+	SetDefault(nil)
+}
+
+// UnmarshalKey decodes the settings under key of the default config into v.
+func UnmarshalKey(key string, v interface{}) error {
+	conf := Default()
+	if conf == nil {
+		return failure.New(liberrors.ErrConfigNotEnabled, failure.Message("Default config is not set"))
+	}
+	return conf.UnmarshalKey(key, v)
+}
+
+// Get returns the value of key in the default config.
+// It returns nil if the key or the default config does not exist.
+func Get(key string) interface{} {
+	conf := Default()
+	if conf == nil {
+		return nil
+	}
+	return conf.Get(key)
+}
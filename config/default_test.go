@@ -0,0 +1,68 @@
+package config
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefault(t *testing.T) {
+	defer ResetDefault()
+
+	ResetDefault()
+	require.Nil(t, Default())
+	require.Nil(t, Get("a.b.c"))
+	var v map[string]string
+	require.True(t, failure.Is(UnmarshalKey("a.b", &v), liberrors.ErrConfigNotEnabled))
+
+	_, err := Init(WithLocalFile(LocalOption{
+		Directory: "./testfixtures/",
+		Filename:  "local",
+	}))
+	require.NoError(t, err)
+	require.Nil(t, Default(), "default is opt-in")
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{
+			Directory: "./testfixtures/",
+			Filename:  "local",
+		}),
+		AsDefault(),
+	)
+	require.NoError(t, err)
+	require.Equal(t, conf, Default())
+	require.Equal(t, "1", Get("a.b.c"))
+	require.Nil(t, Get("a.b.x"))
+	require.NoError(t, UnmarshalKey("a.b", &v))
+	require.Equal(t, map[string]string{"c": "1", "d": "2"}, v)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	values := make(chan interface{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- Default().Reload()
+		}()
+		go func() {
+			defer wg.Done()
+			values <- Get("a.b.c")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(values)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	for val := range values {
+		require.Equal(t, "1", val)
+	}
+
+	ResetDefault()
+	require.Nil(t, Default())
+}
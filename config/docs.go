@@ -0,0 +1,196 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/morikuni/failure"
+)
+
+// KeyDoc is the reference of a config key.
+type KeyDoc struct {
+	Key         string `json:"key"`  // the dotted key.
+	Type        string `json:"type"` // the Go type of the field.
+	Default     string `json:"default,omitempty"`
+	Env         string `json:"env"` // the environment variable name read by WithEnv.
+	Secret      bool   `json:"secret,omitempty"`
+	Description string `json:"description,omitempty"` // the `desc` tag of the field.
+}
+
+type DocsOption struct {
+	Format    string // markdown/html. Default: "markdown"
+	EnvPrefix string // Prefix of the environment variables as EnvOption.Prefix.
+}
+
+var (
+	secretType = reflect.TypeOf(Secret(""))
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+// Describe returns the reference of every key of the config struct v in field order.
+// The default value is the current field value, the key is secret if it is a
+// Secret or contains a secret pattern such as `password`.
+func Describe(v interface{}, envPrefix string) (docs []KeyDoc, err error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		err = failure.Unexpected("config struct required", failure.Context{"type": fmt.Sprintf("%T", v)})
+		return
+	}
+	secrets := &auditor{secretKeys: defaultSecretKeys}
+	describe(rv, "", func(key string, field reflect.StructField, fv reflect.Value) {
+		doc := KeyDoc{
+			Key:         key,
+			Type:        typeName(field.Type),
+			Env:         EnvName(envPrefix, key),
+			Secret:      field.Type == secretType || secrets.secret(key),
+			Description: field.Tag.Get("desc"),
+		}
+		if !fv.IsZero() {
+			doc.Default = fmt.Sprint(fv.Interface())
+			if doc.Secret {
+				doc.Default = masked
+			}
+		}
+		docs = append(docs, doc)
+	})
+	return
+}
+
+func describe(rv reflect.Value, prefix string, fn func(key string, field reflect.StructField, fv reflect.Value)) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, squash := fieldKey(field)
+		if name == "-" {
+			continue
+		}
+		if squash {
+			name = prefix
+		} else if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+			if fv.IsNil() {
+				fv = reflect.New(fv.Type().Elem())
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			describe(fv, name, fn)
+			continue
+		}
+		fn(name, field, fv)
+	}
+}
+
+// typeName returns the type name of the field in the docs.
+func typeName(t reflect.Type) string {
+	switch t {
+	case durationType:
+		return "duration"
+	case secretType:
+		return "string"
+	}
+	if t.Kind() == reflect.Ptr {
+		return typeName(t.Elem())
+	}
+	return t.String()
+}
+
+// WriteDocs writes the reference table of the config struct v in Markdown or HTML.
+func WriteDocs(w io.Writer, v interface{}, opt DocsOption) (err error) {
+	docs, err := Describe(v, opt.EnvPrefix)
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(opt.Format) {
+	case "", "markdown", "md":
+		err = writeMarkdown(w, docs)
+	case "html":
+		err = docsHTML.Execute(w, docs)
+	default:
+		err = failure.Unexpected("unsupported docs format", failure.Context{"format": opt.Format})
+	}
+	return
+}
+
+var mdEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+func writeMarkdown(w io.Writer, docs []KeyDoc) (err error) {
+	code := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "`" + mdEscaper.Replace(s) + "`"
+	}
+	if _, err = io.WriteString(w, "| Key | Type | Default | Env | Secret | Description |\n|---|---|---|---|---|---|\n"); err != nil {
+		return
+	}
+	for _, doc := range docs {
+		secret := ""
+		if doc.Secret {
+			secret = "yes"
+		}
+		if _, err = fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s |\n",
+			code(doc.Key), code(doc.Type), code(doc.Default), code(doc.Env), secret, mdEscaper.Replace(doc.Description),
+		); err != nil {
+			return
+		}
+	}
+	return
+}
+
+var docsHTML = template.Must(template.New("docs").Parse(`<table>
+<thead><tr><th>Key</th><th>Type</th><th>Default</th><th>Env</th><th>Secret</th><th>Description</th></tr></thead>
+<tbody>
+{{- range .}}
+<tr><td><code>{{.Key}}</code></td><td><code>{{.Type}}</code></td><td>{{if .Default}}<code>{{.Default}}</code>{{end}}</td><td><code>{{.Env}}</code></td><td>{{if .Secret}}yes{{end}}</td><td>{{.Description}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+`))
+
+// DocsCommand runs the docs subcommand of the application, e.g. `app config-docs -format html -o docs/config.html`.
+// It writes the reference of the config struct v to stdout unless -o is set.
+func DocsCommand(args []string, v interface{}) (err error) {
+	fs := flag.NewFlagSet("config-docs", flag.ContinueOnError)
+	format := fs.String("format", "markdown", "output format, markdown or html")
+	prefix := fs.String("env-prefix", "", "prefix of the environment variables")
+	output := fs.String("o", "", "output file, default stdout")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		var f *os.File
+		if f, err = os.Create(*output); err != nil {
+			err = failure.Wrap(err, failure.Context{"output": *output})
+			return
+		}
+		defer func() {
+			if e := f.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = f
+	}
+	return WriteDocs(w, v, DocsOption{
+		Format:    *format,
+		EnvPrefix: *prefix,
+	})
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type docsConfig struct {
+	HTTP struct {
+		Port    int           `desc:"listen port"`
+		Timeout time.Duration `mapstructure:"read_timeout" desc:"read | write timeout"`
+	} `mapstructure:"http"`
+	DB *struct {
+		DSN      string `mapstructure:"dsn"`
+		Password Secret `desc:"database password"`
+	} `mapstructure:"db"`
+	Common struct {
+		Tags     []string
+		APIToken string `mapstructure:"api_token"`
+	} `mapstructure:",squash"`
+	Ignored string `mapstructure:"-"`
+	private string
+}
+
+func newDocsConfig() *docsConfig {
+	var c docsConfig
+	c.HTTP.Port = 8080
+	c.HTTP.Timeout = 3 * time.Second
+	c.Common.APIToken = "t0ken"
+	c.Common.Tags = []string{"a", "b"}
+	return &c
+}
+
+func TestDescribe(t *testing.T) {
+	docs, err := Describe(newDocsConfig(), "app")
+	require.NoError(t, err)
+	require.Equal(t, []KeyDoc{
+		{Key: "http.port", Type: "int", Default: "8080", Env: "APP_HTTP_PORT", Description: "listen port"},
+		{Key: "http.read_timeout", Type: "duration", Default: "3s", Env: "APP_HTTP_READ_TIMEOUT", Description: "read | write timeout"},
+		{Key: "db.dsn", Type: "string", Env: "APP_DB_DSN"},
+		{Key: "db.password", Type: "string", Env: "APP_DB_PASSWORD", Secret: true, Description: "database password"},
+		{Key: "tags", Type: "[]string", Default: "[a b]", Env: "APP_TAGS"},
+		{Key: "api_token", Type: "string", Default: "****", Env: "APP_API_TOKEN", Secret: true},
+	}, docs)
+
+	_, err = Describe("x", "")
+	require.Error(t, err)
+}
+
+func TestWriteDocs(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteDocs(&buf, newDocsConfig(), DocsOption{}))
+	require.Contains(t, buf.String(), "| Key | Type | Default | Env | Secret | Description |\n")
+	require.Contains(t, buf.String(), "| `http.read_timeout` | `duration` | `3s` | `HTTP_READ_TIMEOUT` |  | read \\| write timeout |\n")
+	require.Contains(t, buf.String(), "| `api_token` | `string` | `****` | `API_TOKEN` | yes |  |\n")
+
+	buf.Reset()
+	require.NoError(t, WriteDocs(&buf, newDocsConfig(), DocsOption{Format: "html"}))
+	require.Contains(t, buf.String(), "<tr><td><code>db.password</code></td><td><code>string</code></td><td></td><td><code>DB_PASSWORD</code></td><td>yes</td><td>database password</td></tr>")
+
+	require.Error(t, WriteDocs(&buf, newDocsConfig(), DocsOption{Format: "pdf"}))
+}
+
+func TestDocsCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "config.md")
+	require.NoError(t, DocsCommand([]string{"-env-prefix", "APP", "-o", out}, newDocsConfig()))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "`APP_HTTP_PORT`")
+
+	require.Error(t, DocsCommand([]string{"-unknown"}, newDocsConfig()))
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/morikuni/failure"
+)
+
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// EnvName returns the environment variable name of the key.
+// e.g. `http.port` with prefix `APP` is `APP_HTTP_PORT`.
+func EnvName(prefix, key string) string {
+	name := strings.ToUpper(envReplacer.Replace(key))
+	if prefix == "" {
+		return name
+	}
+	return strings.ToUpper(prefix) + "_" + name
+}
+
+// mergeEnv overrides the known keys with the environment variables.
+// The known keys are the keys of the merged config and the registered flags.
+func (s *snapshot) mergeEnv(o option) (err error) {
+	keys := append(s.v.AllKeys(), o.flagNames()...)
+	settings := make(map[string]interface{})
+	for _, key := range keys {
+		if val, ok := os.LookupEnv(EnvName(o.envPrefix, key)); ok {
+			setPath(settings, key, val)
+		}
+	}
+	if err = s.v.MergeConfigMap(settings); err != nil {
+		err = failure.Wrap(err, failure.Context{"env": o.envPrefix})
+	}
+	return
+}
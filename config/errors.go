@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+)
+
+// ParseError is the cause of liberrors.ErrConfigParseFailed. Use errors.As to get the position.
+// Line and Column are 0 if the parser does not report them.
+type ParseError struct {
+	File   string // the file path or the remote source name, empty for Decode.
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString(e.File)
+	if e.Line > 0 {
+		buf.WriteString(":" + strconv.Itoa(e.Line))
+		if e.Column > 0 {
+			buf.WriteString(":" + strconv.Itoa(e.Column))
+		}
+	}
+	if buf.Len() > 0 {
+		buf.WriteString(": ")
+	}
+	buf.WriteString(e.Err.Error())
+	return buf.String()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// positions match the error positions reported by the parsers, the json position is
+// computed from the offset, and the ini/properties/dotenv parsers report no position.
+var positions = []*regexp.Regexp{
+	regexp.MustCompile(`\((\d+), (\d+)\):`), // toml
+	regexp.MustCompile(`At (\d+):(\d+):`),   // hcl
+	regexp.MustCompile(`line (\d+)()`),      // yaml
+}
+
+// parseError returns the ParseError of the document with the position of err.
+func parseError(data []byte, format, name string, err error) error {
+	e := &ParseError{
+		File: name,
+		Err:  err,
+	}
+	if format == "json" {
+		var (
+			v        interface{}
+			syntaxEr *json.SyntaxError
+		)
+		if errors.As(json.Unmarshal(data, &v), &syntaxEr) {
+			e.Line, e.Column = lineColumn(data, syntaxEr.Offset)
+		}
+	}
+	if e.Line == 0 {
+		for _, re := range positions {
+			if m := re.FindStringSubmatch(err.Error()); m != nil {
+				e.Line, _ = strconv.Atoi(m[1])
+				e.Column, _ = strconv.Atoi(m[2])
+				break
+			}
+		}
+	}
+
+	fctx := failure.Context{"type": format}
+	if name != "" {
+		fctx["config"] = name
+	}
+	if e.Line > 0 {
+		fctx["line"] = strconv.Itoa(e.Line)
+		fctx["column"] = strconv.Itoa(e.Column)
+	}
+	return failure.Translate(e, liberrors.ErrConfigParseFailed, fctx)
+}
+
+// lineColumn returns the 1-based position of the byte before offset.
+func lineColumn(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	prefix := data[:offset]
+	line = bytes.Count(prefix, []byte("\n")) + 1
+	column = len(prefix) - bytes.LastIndexByte(prefix, '\n') - 1
+	return
+}
+
+// fileError wraps the error of reading the path, with ErrConfigFileNotFound if it does not exist.
+func fileError(err error, path string) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return failure.Translate(err, liberrors.ErrConfigFileNotFound, failure.Context{"config": path})
+	}
+	return failure.Wrap(err, failure.Context{"config": path})
+}
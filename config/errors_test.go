@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+		line   int
+		column int
+	}{
+		{"yaml", "yaml", "a: 1\nb:\n  c: [\n", 3, 0},
+		{"json", "json", "{\n  \"a\": 1,\n  \"b\" 2\n}", 3, 7},
+		{"toml", "toml", "a = 1\nb = = 2\n", 2, 5},
+		{"hcl", "hcl", "a = 1\nb {\n  c = \n", 4, 2},
+		{"ini", "ini", "[a\nb=1\n", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config."+tt.format)
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0o600))
+
+			_, err := Init(WithLocalFile(LocalOption{Directory: dir}))
+			require.True(t, failure.Is(err, liberrors.ErrConfigParseFailed), err)
+			var parseErr *ParseError
+			require.True(t, errors.As(err, &parseErr))
+			require.Equal(t, path, parseErr.File)
+			require.Equal(t, tt.line, parseErr.Line)
+			require.Equal(t, tt.column, parseErr.Column)
+
+			_, err = Decode([]byte(tt.data), tt.format)
+			require.True(t, failure.Is(err, liberrors.ErrConfigParseFailed))
+		})
+	}
+}
+
+func TestInitErrorCodes(t *testing.T) {
+	conflictDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(conflictDir, "a.yaml"), []byte("a:\n  b: 1\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(conflictDir, "b.yaml"), []byte("a: 1\n"), 0o600))
+
+	tests := []struct {
+		name string
+		opts []Option
+		code failure.StringCode
+	}{
+		{
+			name: "no source",
+			opts: []Option{AsDefault()},
+			code: liberrors.ErrConfigNotEnabled,
+		},
+		{
+			name: "file not found",
+			opts: []Option{WithLocalFile(LocalOption{Directory: t.TempDir()})},
+			code: liberrors.ErrConfigFileNotFound,
+		},
+		{
+			name: "directory not found",
+			opts: []Option{WithBatchFiles(BatchFileOption{Directory: filepath.Join(t.TempDir(), "missing")})},
+			code: liberrors.ErrConfigFileNotFound,
+		},
+		{
+			name: "merge conflict",
+			opts: []Option{WithBatchFiles(BatchFileOption{Directory: conflictDir})},
+			code: liberrors.ErrConfigMergeConflict,
+		},
+		{
+			name: "remote unreachable",
+			opts: []Option{WithConsul(ConsulOption{Endpoint: "127.0.0.1:1"})},
+			code: liberrors.ErrConfigRemoteUnreachable,
+		},
+		{
+			name: "validation failed",
+			opts: []Option{
+				WithSource(&testSource{settings: map[string]interface{}{"x": 1}}),
+				WithValidator(func(Config) error { return errors.New("invalid") }),
+			},
+			code: liberrors.ErrConfigValidationFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Init(tt.opts...)
+			code, ok := failure.CodeOf(err)
+			require.True(t, ok, err)
+			require.Equal(t, tt.code, code, err)
+		})
+	}
+}
+
+func TestConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		dst, src map[string]interface{}
+		key      string
+	}{
+		{"disjoint", map[string]interface{}{"a": 1}, map[string]interface{}{"b": 1}, ""},
+		{"override value", map[string]interface{}{"a": 1}, map[string]interface{}{"a": "x"}, ""},
+		{"nil value", map[string]interface{}{"a": map[string]interface{}{"b": 1}}, map[string]interface{}{"a": nil}, ""},
+		{"map over value", map[string]interface{}{"a": 1}, map[string]interface{}{"A": map[string]interface{}{"b": 1}}, "a"},
+		{"nested value over map", map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}}}, map[string]interface{}{"a": map[interface{}]interface{}{"b": 1}}, "a.b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := conflict(tt.dst, tt.src)
+			require.Equal(t, tt.key != "", ok)
+			require.Equal(t, tt.key, key)
+		})
+	}
+}
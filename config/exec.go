@@ -0,0 +1,142 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/morikuni/failure"
+)
+
+// Limits of the stderr and arguments in the error context.
+const (
+	maxStderr = 1024
+	maxArgs   = 256
+)
+
+type ExecOption struct {
+	Command string        // the command name or path.
+	Args    []string      // the command arguments.
+	Env     []string      // the extra environment variables in `KEY=value` form, added to the process environment.
+	Dir     string        // the working directory. Default: the current directory
+	Type    string        // the file type of the stdout(yaml/toml/json/hcl/ini/dotenv/properties). Default: "yaml"
+	Timeout time.Duration // the timeout of the command. Default: 30s
+}
+
+// WithExec merges the config document printed to stdout by the command,
+// e.g. the secrets rendered by a legacy secret tool.
+// The command runs on Init and every reload, and its stderr is in the error context if it fails.
+// The values of the secret flags and environment variables, e.g. `--token x` or `DB_PASSWORD=x`,
+// are masked in the error context. The processes started by the command are killed on timeout.
+func WithExec(opt ExecOption) Option {
+	if opt.Type == "" {
+		opt.Type = "yaml"
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 30 * time.Second
+	}
+	return WithSource(&execSource{opt: opt})
+}
+
+type execSource struct {
+	opt ExecOption
+}
+
+func (s *execSource) Name() string {
+	return "exec://" + s.opt.Command
+}
+
+func (s *execSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.opt.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.opt.Command, s.opt.Args...)
+	cmd.Env = append(os.Environ(), s.opt.Env...)
+	cmd.Dir = s.opt.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				killProcessGroup(cmd)
+			case <-done:
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+	}
+	if err != nil {
+		args, secrets := s.redact()
+		msg := strings.TrimSpace(stderr.String())
+		for _, secret := range secrets {
+			msg = strings.ReplaceAll(msg, secret, masked)
+		}
+		fctx := failure.Context{
+			"source": s.Name(),
+			"args":   truncate(strings.Join(args, " "), maxArgs),
+			"stderr": truncate(msg, maxStderr),
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			fctx["timeout"] = s.opt.Timeout.String()
+		}
+		return nil, failure.Wrap(err, fctx)
+	}
+	return decode(stdout.Bytes(), s.opt.Type, s.Name())
+}
+
+// redact returns the arguments with the values of the secret flags masked,
+// and the secret values of the arguments and environment variables.
+func (s *execSource) redact() (args, secrets []string) {
+	a := &auditor{secretKeys: defaultSecretKeys}
+	args = make([]string, len(s.opt.Args))
+	copy(args, s.opt.Args)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name := strings.ReplaceAll(strings.ToLower(strings.TrimLeft(args[i], "-")), "-", "_")
+		if j := strings.Index(name, "="); j >= 0 {
+			if a.secret(name[:j]) {
+				k := strings.Index(args[i], "=")
+				secrets = append(secrets, args[i][k+1:])
+				args[i] = args[i][:k+1] + masked
+			}
+			continue
+		}
+		if a.secret(name) && i+1 < len(args) {
+			i++
+			secrets = append(secrets, args[i])
+			args[i] = masked
+		}
+	}
+	for _, env := range s.opt.Env {
+		if k := strings.Index(env, "="); k >= 0 && a.secret(strings.ToLower(env[:k])) {
+			secrets = append(secrets, env[k+1:])
+		}
+	}
+	n := 0
+	for _, secret := range secrets {
+		if secret != "" {
+			secrets[n] = secret
+			n++
+		}
+	}
+	return args, secrets[:n]
+}
+
+// truncate returns s cut to n bytes.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
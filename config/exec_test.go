@@ -0,0 +1,82 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithExec(t *testing.T) {
+	conf, err := Init(WithExec(ExecOption{
+		Command: "sh",
+		Args:    []string{"-c", `printf '{"db": {"password": "%s"}}' "$DB_PASSWORD"`},
+		Env:     []string{"DB_PASSWORD=p@ss"},
+		Type:    "json",
+	}))
+	require.NoError(t, err)
+	require.Equal(t, "p@ss", conf.Get("db.password"))
+	require.Equal(t, []SourceInfo{{Name: "exec://sh"}}, conf.Sources())
+
+	tests := []struct {
+		name    string
+		opt     ExecOption
+		context map[string]string
+		code    failure.StringCode
+	}{
+		{
+			name:    "failed",
+			opt:     ExecOption{Command: "sh", Args: []string{"-c", "echo 'vault sealed' >&2; exit 2"}},
+			context: map[string]string{"stderr": "vault sealed"},
+			code:    liberrors.ErrConfigReadFailed,
+		},
+		{
+			name:    "timeout",
+			opt:     ExecOption{Command: "sleep", Args: []string{"5"}, Timeout: 50 * time.Millisecond},
+			context: map[string]string{"timeout": "50ms"},
+			code:    liberrors.ErrConfigReadFailed,
+		},
+		{
+			name:    "timeout of child processes",
+			opt:     ExecOption{Command: "sh", Args: []string{"-c", "sleep 3; echo x: 1"}, Timeout: 50 * time.Millisecond},
+			context: map[string]string{"timeout": "50ms"},
+			code:    liberrors.ErrConfigReadFailed,
+		},
+		{
+			name: "malformed output",
+			opt:  ExecOption{Command: "echo", Args: []string{"x: ["}},
+			code: liberrors.ErrConfigParseFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := Init(WithExec(tt.opt))
+			require.True(t, failure.Is(err, tt.code), err)
+			require.Less(t, time.Since(start), time.Second)
+			for k, v := range tt.context {
+				require.Contains(t, err.Error(), k+"="+v)
+			}
+		})
+	}
+}
+
+func TestWithExec_Redact(t *testing.T) {
+	_, err := Init(WithExec(ExecOption{
+		Command: "sh",
+		Args:    []string{"-c", `echo "token $2 or $DB_PASSWORD rejected" >&2; exit 1`, "sh", "--token", "s3cret", "--api-key=k3y"},
+		Env:     []string{"DB_PASSWORD=p@ss"},
+	}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigReadFailed), err)
+	msg := err.Error()
+	require.Contains(t, msg, "stderr=token **** or **** rejected")
+	require.Contains(t, msg, "--token **** --api-key=****")
+	for _, secret := range []string{"s3cret", "k3y", "p@ss"} {
+		require.NotContains(t, msg, secret)
+	}
+}
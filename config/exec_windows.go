@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package config
+
+import "os/exec"
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command. The processes it starts are not killed on windows.
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/morikuni/failure"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+)
+
+// flagNames returns the names of all registered flags.
+func (o option) flagNames() (names []string) {
+	for _, fs := range o.pflags {
+		fs.VisitAll(func(f *pflag.Flag) {
+			names = append(names, f.Name)
+		})
+	}
+	for _, fs := range o.goflags {
+		fs.VisitAll(func(f *flag.Flag) {
+			names = append(names, f.Name)
+		})
+	}
+	return
+}
+
+// mergeFlags overrides the config with the explicitly set flags.
+// The flags left as default are ignored.
+func (s *snapshot) mergeFlags(o option) (err error) {
+	settings := make(map[string]interface{})
+	for _, fs := range o.goflags {
+		fs.Visit(func(f *flag.Flag) {
+			if g, ok := f.Value.(flag.Getter); ok {
+				setPath(settings, f.Name, g.Get())
+				return
+			}
+			setPath(settings, f.Name, f.Value.String())
+		})
+	}
+	for _, fs := range o.pflags {
+		fs.Visit(func(f *pflag.Flag) {
+			setPath(settings, f.Name, pflagValue(f))
+		})
+	}
+	if err = s.v.MergeConfigMap(settings); err != nil {
+		err = failure.Wrap(err, failure.Message("Merge flags failed"))
+	}
+	return
+}
+
+func pflagValue(f *pflag.Flag) interface{} {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return sv.GetSlice()
+	}
+	val := f.Value.String()
+	switch f.Value.Type() {
+	case "bool":
+		return cast.ToBool(val)
+	case "int", "int8", "int16", "int32", "int64":
+		return cast.ToInt64(val)
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return cast.ToUint64(val)
+	case "float32", "float64":
+		return cast.ToFloat64(val)
+	default:
+		return val
+	}
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	stringsType  = reflect.TypeOf([]string(nil))
+)
+
+// RegisterFlags defines a flag for every field of the config struct v.
+// The flag name is the dotted config key, e.g. `--http.port`, the default
+// value is the current field value and the usage is the `desc` tag.
+// The Secret fields have no default, so the usage does not print the secrets.
+// Fields of unsupported types are skipped.
+func RegisterFlags(fs *pflag.FlagSet, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return failure.Unexpected("config struct required", failure.Context{"type": fmt.Sprintf("%T", v)})
+	}
+	registerFlags(fs, rv, "")
+	return nil
+}
+
+func registerFlags(fs *pflag.FlagSet, rv reflect.Value, prefix string) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, squash := fieldKey(field)
+		if name == "-" {
+			continue
+		}
+		if squash {
+			name = prefix
+		} else if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fv := rv.Field(i)
+		usage := field.Tag.Get("desc")
+		switch {
+		case field.Type == durationType:
+			fs.Duration(name, time.Duration(fv.Int()), usage)
+		case fv.Kind() == reflect.Struct:
+			registerFlags(fs, fv, name)
+		case field.Type == secretType:
+			fs.String(name, "", usage)
+		case fv.Kind() == reflect.String:
+			fs.String(name, fv.String(), usage)
+		case fv.Kind() == reflect.Bool:
+			fs.Bool(name, fv.Bool(), usage)
+		case fv.Kind() >= reflect.Int && fv.Kind() <= reflect.Int64:
+			fs.Int64(name, fv.Int(), usage)
+		case fv.Kind() >= reflect.Uint && fv.Kind() <= reflect.Uint64:
+			fs.Uint64(name, fv.Uint(), usage)
+		case fv.Kind() == reflect.Float32 || fv.Kind() == reflect.Float64:
+			fs.Float64(name, fv.Float(), usage)
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+			fs.StringSlice(name, fv.Convert(stringsType).Interface().([]string), usage)
+		}
+	}
+}
+
+// fieldKey returns the config key of the struct field as mapstructure decodes it.
+func fieldKey(field reflect.StructField) (name string, squash bool) {
+	tag := field.Tag.Get("mapstructure")
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "squash" {
+			squash = true
+		}
+	}
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	return strings.ToLower(name), squash
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithFlags(t *testing.T) {
+	t.Setenv("APP_A_B_C", "env")
+	t.Setenv("APP_A_B_D", "env")
+	t.Setenv("APP_A_B_E", "env")
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("a.b.c", "default", "")
+	fs.String("a.b.f", "default", "")
+	fs.Int("http.port", 80, "")
+	fs.StringSlice("http.hosts", nil, "")
+	require.NoError(t, fs.Parse([]string{"--a.b.c=flag", "--http.port=8080", "--http.hosts=a,b"}))
+
+	gfs := flag.NewFlagSet("test", flag.ContinueOnError)
+	gfs.Bool("debug", false, "")
+	gfs.Duration("http.timeout", time.Second, "")
+	require.NoError(t, gfs.Parse([]string{"-debug", "-http.timeout=3s"}))
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{
+			Directory: "./testfixtures/",
+			Filename:  "local",
+		}),
+		WithEnv(EnvOption{Prefix: "APP"}),
+		WithFlags(fs),
+		WithGoFlags(gfs),
+	)
+	require.NoError(t, err)
+
+	var c struct {
+		A struct {
+			B struct {
+				C string
+				D string
+				E string
+				F string
+			}
+		}
+		HTTP struct {
+			Port    int
+			Hosts   []string
+			Timeout time.Duration
+		}
+		Debug bool
+	}
+	require.NoError(t, conf.Unmarshal(&c))
+	require.Equal(t, "flag", c.A.B.C)
+	require.Equal(t, "env", c.A.B.D)
+	require.Equal(t, "", c.A.B.E, "unknown keys are not read from env")
+	require.Equal(t, "", c.A.B.F, "default flags are ignored")
+	require.Equal(t, 8080, c.HTTP.Port)
+	require.Equal(t, []string{"a", "b"}, c.HTTP.Hosts)
+	require.Equal(t, 3*time.Second, c.HTTP.Timeout)
+	require.True(t, c.Debug)
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		key    string
+		want   string
+	}{
+		{
+			name: "no prefix",
+			key:  "http.port",
+			want: "HTTP_PORT",
+		},
+		{
+			name:   "prefix",
+			prefix: "app",
+			key:    "http.read-timeout",
+			want:   "APP_HTTP_READ_TIMEOUT",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, EnvName(tt.prefix, tt.key))
+		})
+	}
+}
+
+func TestRegisterFlags(t *testing.T) {
+	type Base struct {
+		Name string `desc:"service name"`
+	}
+	type HTTP struct {
+		Port    int           `desc:"listen port"`
+		Timeout time.Duration `mapstructure:"read_timeout"`
+		Hosts   []string
+	}
+	c := struct {
+		Base  `mapstructure:",squash"`
+		HTTP  HTTP
+		Ratio float64
+		Debug bool
+		Skip  string `mapstructure:"-"`
+		Map   map[string]string
+		Token Secret `desc:"api token"`
+		inner string
+	}{
+		Base:  Base{Name: "svc"},
+		HTTP:  HTTP{Port: 80},
+		Token: "hunter2",
+	}
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	require.NoError(t, RegisterFlags(fs, &c))
+	require.Error(t, RegisterFlags(fs, "string"))
+
+	var names []string
+	fs.VisitAll(func(f *pflag.Flag) {
+		names = append(names, f.Name)
+	})
+	require.ElementsMatch(t, []string{"name", "http.port", "http.read_timeout", "http.hosts", "ratio", "debug", "token"}, names)
+	require.Equal(t, "80", fs.Lookup("http.port").DefValue)
+	require.Equal(t, "listen port", fs.Lookup("http.port").Usage)
+	require.Equal(t, "svc", fs.Lookup("name").DefValue)
+	require.Empty(t, fs.Lookup("token").DefValue)
+	require.Contains(t, fs.FlagUsages(), "api token")
+	require.NotContains(t, fs.FlagUsages(), "hunter2", "the usage does not print the secret")
+
+	require.NoError(t, fs.Parse([]string{"--http.port=8080", "--name=api", "--token=t1"}))
+	conf, err := Init(WithFlags(fs))
+	require.NoError(t, err)
+	require.NoError(t, conf.Unmarshal(&c))
+	require.Equal(t, 8080, c.HTTP.Port)
+	require.Equal(t, "api", c.Name)
+	require.Equal(t, "t1", c.Token.Reveal())
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/morikuni/failure"
+	"github.com/spf13/viper"
+)
+
+// formats maps the supported file extensions to the config types.
+var formats = map[string]string{
+	"json":       "json",
+	"toml":       "toml",
+	"yaml":       "yaml",
+	"yml":        "yaml",
+	"properties": "properties",
+	"props":      "properties",
+	"prop":       "properties",
+	"hcl":        "hcl",
+	"tfvars":     "hcl",
+	"dotenv":     "dotenv",
+	"env":        "dotenv",
+	"ini":        "ini",
+}
+
+// exts is the lookup order of the file extensions.
+var exts = []string{"yaml", "yml", "json", "toml", "hcl", "tfvars", "ini", "properties", "props", "prop", "env", "dotenv"}
+
+// formatOf returns the config type of the file inferred from its extension.
+func formatOf(path string) (format string, ok bool) {
+	format, ok = formats[strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))]
+	return
+}
+
+// findFile returns the path of `<dir>/<name>.<ext>` and its config type.
+// The extension is any of the ftype's extensions, or any supported extension if ftype is empty.
+func findFile(dir, name, ftype string) (path, format string, err error) {
+	for _, ext := range exts {
+		format = formats[ext]
+		if ftype != "" && format != formats[ftype] {
+			continue
+		}
+		path = filepath.Join(dir, name+"."+ext)
+		if _, err = os.Stat(path); err == nil {
+			return
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			err = fileError(err, path)
+			return
+		}
+	}
+	path = filepath.Join(dir, name+"."+ftype)
+	if ftype == "" {
+		path = filepath.Join(dir, name+".*")
+	}
+	err = fileError(os.ErrNotExist, path)
+	return
+}
+
+// readFile reads the file in the config type, and verifies its signature if ver is not nil.
+func readFile(path, format string, ver *verifier) (settings map[string]interface{}, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = fileError(err, path)
+		return
+	}
+	if err = ver.verifyFile(path, data); err != nil {
+		return
+	}
+	settings, err = decode(data, format, path)
+	return
+}
+
+// Decode parses the document in the config type(yaml/toml/json/hcl/ini/dotenv/properties).
+// The keys are normalized to the nested maps whatever the format is:
+//   - dotenv: `A__B=1` is `a.b`.
+//   - ini: the keys of the default section are top level keys.
+//   - hcl: the single blocks are maps instead of lists of maps.
+//
+// The syntax errors are ErrConfigParseFailed caused by *ParseError.
+func Decode(data []byte, format string) (settings map[string]interface{}, err error) {
+	return decode(data, format, "")
+}
+
+// decode decodes the document read from the named file or source.
+func decode(data []byte, format, name string) (settings map[string]interface{}, err error) {
+	if f, ok := formats[format]; ok {
+		format = f
+	}
+	v := viper.New()
+	v.SetConfigType(format)
+	if err = v.ReadConfig(bytes.NewReader(data)); err != nil {
+		var parseErr viper.ConfigParseError
+		if errors.As(err, &parseErr) {
+			err = parseError(data, format, name, err)
+			return
+		}
+		err = failure.Wrap(err, failure.Context{"type": format})
+		return
+	}
+	settings = normalize(format, v)
+	return
+}
+
+func normalize(format string, v *viper.Viper) map[string]interface{} {
+	settings := v.AllSettings()
+	switch format {
+	case "dotenv":
+		out := make(map[string]interface{}, len(settings))
+		for _, k := range v.AllKeys() {
+			setPath(out, strings.ReplaceAll(k, "__", "."), v.Get(k))
+		}
+		return out
+	case "ini":
+		if def, ok := settings["default"].(map[string]interface{}); ok {
+			delete(settings, "default")
+			for k, v := range def {
+				if _, exists := settings[k]; !exists {
+					settings[k] = v
+				}
+			}
+		}
+		return settings
+	case "hcl":
+		return unwrapBlocks(settings).(map[string]interface{})
+	default:
+		return settings
+	}
+}
+
+// unwrapBlocks replaces the single element lists of maps of HCL blocks with the maps.
+func unwrapBlocks(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = unwrapBlocks(val[k])
+		}
+		return val
+	case []map[string]interface{}:
+		if len(val) == 1 {
+			return unwrapBlocks(val[0])
+		}
+		out := make([]interface{}, len(val))
+		for i := range val {
+			out[i] = unwrapBlocks(val[i])
+		}
+		return out
+	default:
+		return v
+	}
+}
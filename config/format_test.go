@@ -0,0 +1,114 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormats(t *testing.T) {
+	type configKV struct {
+		key   string
+		value string
+	}
+	tests := []struct {
+		name     string
+		opt      Option
+		wantConf []configKV
+
+		assertion require.ErrorAssertionFunc
+	}{
+		{
+			name: "dotenv",
+			opt: WithLocalFile(LocalOption{
+				Directory: "./testfixtures/formats/",
+				Filename:  "app",
+				Type:      "env",
+			}),
+			wantConf: []configKV{
+				{"dotenv.a.b", "1"},
+				{"dotenv_name", "dotenv"},
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "ini",
+			opt: WithLocalFile(LocalOption{
+				Directory: "./testfixtures/formats/",
+				Filename:  "app",
+				Type:      "ini",
+			}),
+			wantConf: []configKV{
+				{"ini.a.b", "1"},
+				{"ini_name", "ini"},
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "hcl inferred",
+			opt: WithLocalFile(LocalOption{
+				Directory: "./testfixtures/formats/",
+				Filename:  "app",
+			}),
+			wantConf: []configKV{
+				{"hcl.a.b", "1"},
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "properties",
+			opt: WithLocalFile(LocalOption{
+				Directory: "./testfixtures/formats/",
+				Filename:  "app",
+				Type:      "props",
+			}),
+			wantConf: []configKV{
+				{"properties.a.b", "1"},
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "type not found",
+			opt: WithLocalFile(LocalOption{
+				Directory: "./testfixtures/formats/",
+				Filename:  "app",
+				Type:      "yaml",
+			}),
+			assertion: require.Error,
+		},
+		{
+			name: "batch mixed types",
+			opt: WithBatchFiles(BatchFileOption{
+				Directory: "./testfixtures/formats/",
+			}),
+			wantConf: []configKV{
+				{"dotenv.a.b", "1"},
+				{"ini.a.b", "1"},
+				{"hcl.a.b", "1"},
+				{"properties.a.b", "1"},
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "batch single type",
+			opt: WithBatchFiles(BatchFileOption{
+				Directory: "./testfixtures/formats/",
+				Type:      "ini",
+			}),
+			wantConf: []configKV{
+				{"dotenv.a.b", ""},
+				{"ini.a.b", "1"},
+			},
+			assertion: require.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotConf, err := Init(tt.opt)
+			tt.assertion(t, err)
+			for i := range tt.wantConf {
+				require.Equal(t, tt.wantConf[i].value, gotConf.(*config).current().GetString(tt.wantConf[i].key))
+			}
+		})
+	}
+}
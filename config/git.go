@@ -0,0 +1,160 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/rs/zerolog/log"
+)
+
+type GitOption struct {
+	Repository string // the path of the local checkout or bare repository.
+	Ref        string // the branch, tag or commit. Default: "HEAD"
+	Path       string // the file path in the repository. Default: "config.yaml"
+	Type       string // the file type of the file(yaml/toml/json/hcl/ini/dotenv/properties). Default: inferred from the file extension
+
+	Fetch        bool          // run `git fetch` before resolving the ref, for the refs tracking a remote.
+	PollInterval time.Duration // the interval of polling new commits on the ref. Default: no polling
+}
+
+// WithGit merges the config file committed in the git repository.
+// The commit hash is reported in the provenance of the source, and the
+// config reloads when a new commit is found on the ref.
+func WithGit(opt GitOption) Option {
+	if opt.Ref == "" {
+		opt.Ref = "HEAD"
+	}
+	if opt.Path == "" {
+		opt.Path = "config.yaml"
+	}
+	if opt.Type == "" {
+		opt.Type, _ = formatOf(opt.Path)
+	}
+	return WithSource(&gitSource{opt: opt})
+}
+
+type gitSource struct {
+	opt GitOption
+
+	mu     sync.Mutex
+	commit string // the commit of the last Load.
+}
+
+func (s *gitSource) Name() string {
+	return "git://" + s.opt.Repository + "@" + s.opt.Ref + "/" + s.opt.Path
+}
+
+func (s *gitSource) Load(ctx context.Context) (settings map[string]interface{}, err error) {
+	commit, err := s.resolve(ctx)
+	if err != nil {
+		return
+	}
+	data, err := s.git(ctx, "show", commit+":"+s.opt.Path)
+	if err != nil {
+		err = failure.Wrap(err, failure.Context{"commit": commit})
+		return
+	}
+	if settings, err = decode(data, s.opt.Type, s.Name()); err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.commit = commit
+	s.mu.Unlock()
+	return
+}
+
+// Metadata returns the commit of the last Load.
+func (s *gitSource) Metadata() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]string{
+		"ref":    s.opt.Ref,
+		"commit": s.commit,
+	}
+}
+
+// Watch polls the ref and notifies when it points to a new commit.
+func (s *gitSource) Watch(ctx context.Context, notify func()) error {
+	if s.opt.PollInterval <= 0 {
+		return nil
+	}
+	go func() {
+		ticker := time.NewTicker(s.opt.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			commit, err := s.resolve(ctx)
+			if err != nil {
+				log.Warn().Err(err).Str("source", s.Name()).Msg("Poll config failed")
+				continue
+			}
+			s.mu.Lock()
+			changed := commit != s.commit
+			s.mu.Unlock()
+			if changed {
+				notify()
+			}
+		}
+	}()
+	return nil
+}
+
+// resolve returns the commit hash of the ref.
+func (s *gitSource) resolve(ctx context.Context) (commit string, err error) {
+	if s.opt.Fetch {
+		if _, err = s.git(ctx, "fetch", "--quiet"); err != nil {
+			err = failure.Translate(err, liberrors.ErrConfigRemoteUnreachable)
+			return
+		}
+	}
+	out, err := s.git(ctx, "rev-parse", "--verify", "--end-of-options", s.opt.Ref+"^{commit}")
+	if err != nil {
+		return
+	}
+	commit = strings.TrimSpace(string(out))
+	return
+}
+
+// gitNotFound are the git errors of the unknown ref or file.
+var gitNotFound = []string{
+	"unknown revision",
+	"Needed a single revision",
+	"invalid object name",
+	"does not exist in",
+}
+
+// git runs the git command in the repository and returns its stdout.
+// The failures are ErrConfigKeyNotFound if the ref or file is unknown, or ErrConfigReadFailed.
+func (s *gitSource) git(ctx context.Context, args ...string) (out []byte, err error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", s.opt.Repository}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		code := liberrors.ErrConfigReadFailed
+		for _, pattern := range gitNotFound {
+			if strings.Contains(msg, pattern) {
+				code = liberrors.ErrConfigKeyNotFound
+				break
+			}
+		}
+		err = failure.Translate(err, code, failure.Context{
+			"source": s.Name(),
+			"args":   strings.Join(args, " "),
+			"stderr": msg,
+		})
+		return
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+// gitRun runs the git command in dir and returns its trimmed output.
+func gitRun(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func gitInit(t *testing.T, dir string) {
+	gitRun(t, dir, "init", "-q")
+	gitRun(t, dir, "symbolic-ref", "HEAD", "refs/heads/main")
+}
+
+func gitCommit(t *testing.T, dir, path, content string) string {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(content), 0o600))
+	gitRun(t, dir, "add", path)
+	gitRun(t, dir, "commit", "-q", "-m", "update "+path)
+	return gitRun(t, dir, "rev-parse", "HEAD")
+}
+
+func TestWithGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Skip tests because git is not available")
+	}
+	work := t.TempDir()
+	gitInit(t, work)
+	first := gitCommit(t, work, "app/config.yaml", "x: 1\n")
+	gitRun(t, work, "tag", "v1")
+	second := gitCommit(t, work, "app/config.yaml", "x: 2\n")
+
+	bare := filepath.Join(t.TempDir(), "config.git")
+	gitRun(t, work, "clone", "-q", "--bare", work, bare)
+
+	tests := []struct {
+		name   string
+		opt    GitOption
+		want   int
+		commit string
+	}{
+		{"checkout head", GitOption{Repository: work, Path: "app/config.yaml"}, 2, second},
+		{"bare tag", GitOption{Repository: bare, Ref: "v1", Path: "app/config.yaml"}, 1, first},
+		{"bare branch", GitOption{Repository: bare, Ref: "main", Path: "app/config.yaml"}, 2, second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := Init(WithGit(tt.opt))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, conf.Get("x"))
+			sources := conf.Sources()
+			require.Len(t, sources, 1)
+			require.Equal(t, tt.commit, sources[0].Metadata["commit"])
+		})
+	}
+
+	_, err := Init(WithGit(GitOption{Repository: bare, Ref: "missing", Path: "app/config.yaml"}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigKeyNotFound), err)
+	_, err = Init(WithGit(GitOption{Repository: bare, Path: "missing.yaml"}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigKeyNotFound), err)
+
+	_, err = Init(WithGit(GitOption{Repository: t.TempDir()}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigReadFailed), "not a repository")
+	require.Contains(t, err.Error(), "not a git repository")
+
+	corrupt := filepath.Join(t.TempDir(), "corrupt.git")
+	gitRun(t, work, "clone", "-q", "--bare", "--no-hardlinks", work, corrupt)
+	blob := gitRun(t, corrupt, "rev-parse", "HEAD:app/config.yaml")
+	require.NoError(t, os.Remove(filepath.Join(corrupt, "objects", blob[:2], blob[2:])))
+	_, err = Init(WithGit(GitOption{Repository: corrupt, Path: "app/config.yaml"}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigReadFailed), err)
+	require.False(t, failure.Is(err, liberrors.ErrConfigKeyNotFound), err)
+}
+
+func TestWithGit_Poll(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Skip tests because git is not available")
+	}
+	work := t.TempDir()
+	gitInit(t, work)
+	gitCommit(t, work, "config.yaml", "x: 1\n")
+
+	conf, err := Init(WithGit(GitOption{
+		Repository:   work,
+		Ref:          "main",
+		PollInterval: 10 * time.Millisecond,
+	}))
+	require.NoError(t, err)
+	defer conf.Close()
+
+	changed := make(chan struct{}, 1)
+	conf.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	commit := gitCommit(t, work, "config.yaml", "x: 2\n")
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("config is not reloaded")
+	}
+	require.Equal(t, 2, conf.Get("x"))
+	require.Equal(t, commit, conf.Sources()[0].Metadata["commit"])
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/rs/zerolog/log"
+)
+
+type HTTPOption struct {
+	URL  string // the URL of the config document.
+	Type string // the file type of the document(yaml/toml/json/hcl/ini/dotenv/properties). Default: inferred from the URL path, or "yaml"
+
+	Token    string // the bearer token.
+	CertFile string // the client certificate of mTLS.
+	KeyFile  string // the client key of mTLS.
+	CAFile   string // the CA certificates of the server. Default: the system CAs
+
+	PollInterval time.Duration // the interval of polling the changes. Default: no polling
+	Timeout      time.Duration // the timeout of a fetch, ignored if Client is set. Default: 30s
+	Client       *http.Client  // the HTTP client, the TLS files are ignored if set. Default: a client of the TLS files and Timeout
+}
+
+// WithHTTPSource merges the config document fetched from the URL.
+// The document is polled with If-None-Match, and the config reloads when it changes.
+func WithHTTPSource(opt HTTPOption) Option {
+	if opt.Timeout <= 0 {
+		opt.Timeout = 30 * time.Second
+	}
+	if opt.Type == "" {
+		opt.Type = "yaml"
+		if u, err := url.Parse(opt.URL); err == nil {
+			if format, ok := formatOf(u.Path); ok {
+				opt.Type = format
+			}
+		}
+	}
+	return WithSource(&httpSource{opt: opt})
+}
+
+type httpSource struct {
+	opt HTTPOption
+
+	mu     sync.Mutex
+	client *http.Client
+	etag   string
+	data   []byte
+}
+
+func (s *httpSource) Name() string {
+	u, err := url.Parse(s.opt.URL)
+	if err != nil {
+		return s.opt.URL
+	}
+	u.RawQuery = ""
+	return u.Redacted()
+}
+
+func (s *httpSource) Load(ctx context.Context) (settings map[string]interface{}, err error) {
+	if _, err = s.fetch(ctx); err != nil {
+		return
+	}
+	s.mu.Lock()
+	data := s.data
+	s.mu.Unlock()
+	return decode(data, s.opt.Type, s.Name())
+}
+
+// Watch polls the document and notifies when it changes.
+func (s *httpSource) Watch(ctx context.Context, notify func()) error {
+	if s.opt.PollInterval <= 0 {
+		return nil
+	}
+	go func() {
+		ticker := time.NewTicker(s.opt.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			changed, err := s.fetch(ctx)
+			if err != nil {
+				log.Warn().Err(err).Str("source", s.Name()).Msg("Poll config failed")
+				continue
+			}
+			if changed {
+				notify()
+			}
+		}
+	}()
+	return nil
+}
+
+// fetch downloads the document unless it is not modified since the last fetch.
+func (s *httpSource) fetch(ctx context.Context) (bool, error) {
+	fctx := failure.Context{"source": s.Name()}
+	client, err := s.httpClient()
+	if err != nil {
+		return false, failure.Wrap(err, fctx)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.opt.URL, nil)
+	if err != nil {
+		return false, failure.Wrap(err, fctx)
+	}
+	if s.opt.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.opt.Token)
+	}
+	s.mu.Lock()
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	s.mu.Unlock()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, fctx)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return false, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return false, failure.New(liberrors.ErrConfigKeyNotFound, fctx)
+	case resp.StatusCode >= http.StatusBadRequest:
+		return false, failure.New(liberrors.ErrConfigReadFailed,
+			failure.Messagef("Config server responds %d", resp.StatusCode),
+			fctx,
+		)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, fctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.data == nil || !bytes.Equal(s.data, data)
+	s.etag = resp.Header.Get("ETag")
+	s.data = data
+	return changed, nil
+}
+
+// httpClient returns the client of the option, or builds the client of the TLS files once.
+func (s *httpSource) httpClient() (*http.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+	if s.opt.Client != nil {
+		s.client = s.opt.Client
+		return s.client, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.opt.CertFile != "" || s.opt.CAFile != "" {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if s.opt.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(s.opt.CertFile, s.opt.KeyFile)
+			if err != nil {
+				return nil, failure.Wrap(err, failure.Context{"cert": s.opt.CertFile, "key": s.opt.KeyFile})
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		if s.opt.CAFile != "" {
+			pem, err := os.ReadFile(s.opt.CAFile)
+			if err != nil {
+				return nil, fileError(err, s.opt.CAFile)
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, failure.New(liberrors.ErrConfigReadFailed,
+					failure.Message("No CA certificate found"),
+					failure.Context{"ca": s.opt.CAFile},
+				)
+			}
+		}
+		transport.TLSClientConfig = cfg
+	}
+	s.client = &http.Client{
+		Transport: transport,
+		Timeout:   s.opt.Timeout,
+	}
+	return s.client, nil
+}
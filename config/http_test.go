@@ -0,0 +1,211 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConfigServer serves a config document with ETag.
+type fakeConfigServer struct {
+	mu          sync.Mutex
+	doc         string
+	version     int
+	fetches     int
+	notModified int
+}
+
+func (f *fakeConfigServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path != "/app/config.json" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	etag := fmt.Sprintf(`"v%d"`, f.version)
+	if r.Header.Get("If-None-Match") == etag {
+		f.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	f.fetches++
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write([]byte(f.doc))
+}
+
+func (f *fakeConfigServer) set(doc string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.doc = doc
+	f.version++
+}
+
+func (f *fakeConfigServer) counts() (fetches, notModified int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches, f.notModified
+}
+
+func TestWithHTTPSource(t *testing.T) {
+	fake := &fakeConfigServer{doc: `{"http": {"port": 8080}}`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	conf, err := Init(WithHTTPSource(HTTPOption{
+		URL:          server.URL + "/app/config.json?env=prod",
+		Token:        "token",
+		PollInterval: 10 * time.Millisecond,
+	}))
+	require.NoError(t, err)
+	defer conf.Close()
+	require.Equal(t, 8080.0, conf.Get("http.port"))
+	require.Equal(t, []SourceInfo{{Name: server.URL + "/app/config.json"}}, conf.Sources())
+
+	changed := make(chan struct{}, 1)
+	conf.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	require.Eventually(t, func() bool {
+		_, notModified := fake.counts()
+		return notModified >= 2
+	}, time.Second, 5*time.Millisecond, "polls are not modified")
+	fetches, _ := fake.counts()
+	require.Equal(t, 1, fetches)
+
+	fake.set(`{"http": {"port": 9090}}`)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("config is not reloaded")
+	}
+	require.Equal(t, 9090.0, conf.Get("http.port"))
+	fetches, _ = fake.counts()
+	require.Equal(t, 2, fetches, "the reload uses the polled document")
+}
+
+func TestWithHTTPSource_Errors(t *testing.T) {
+	server := httptest.NewServer(&fakeConfigServer{doc: `{}`})
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		opt  HTTPOption
+		code failure.StringCode
+	}{
+		{"unauthorized", HTTPOption{URL: server.URL + "/app/config.json"}, liberrors.ErrConfigReadFailed},
+		{"not found", HTTPOption{URL: server.URL + "/app/other.json", Token: "token"}, liberrors.ErrConfigKeyNotFound},
+		{"unreachable", HTTPOption{URL: "http://127.0.0.1:1/config.json"}, liberrors.ErrConfigRemoteUnreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Init(WithHTTPSource(tt.opt))
+			require.True(t, failure.Is(err, tt.code), err)
+		})
+	}
+}
+
+func TestWithHTTPSource_Timeout(t *testing.T) {
+	hung := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer server.Close()
+	defer close(hung)
+
+	start := time.Now()
+	_, err := Init(WithHTTPSource(HTTPOption{
+		URL:     server.URL + "/config.yaml",
+		Timeout: 50 * time.Millisecond,
+	}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigRemoteUnreachable), err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestWithHTTPSource_MTLS(t *testing.T) {
+	dir := t.TempDir()
+	caKey, caCert := newCert(t, "ca", nil, nil)
+	clientKey, clientCert := newCert(t, "client", caKey, caCert)
+	writePEM(t, filepath.Join(dir, "client.crt"), "CERTIFICATE", clientCert.Raw)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "client.key"), "EC PRIVATE KEY", keyDER)
+
+	server := httptest.NewUnstartedServer(&fakeConfigServer{doc: "http:\n  port: 8443\n"})
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+	writePEM(t, filepath.Join(dir, "server.crt"), "CERTIFICATE", server.Certificate().Raw)
+
+	opt := HTTPOption{
+		URL:    server.URL + "/app/config.json",
+		Type:   "yaml",
+		Token:  "token",
+		CAFile: filepath.Join(dir, "server.crt"),
+	}
+	_, err = Init(WithHTTPSource(opt))
+	require.True(t, failure.Is(err, liberrors.ErrConfigRemoteUnreachable), "client certificate required")
+
+	opt.CertFile = filepath.Join(dir, "client.crt")
+	opt.KeyFile = filepath.Join(dir, "client.key")
+	conf, err := Init(WithHTTPSource(opt))
+	require.NoError(t, err)
+	require.Equal(t, 8443, conf.Get("http.port"))
+}
+
+// newCert returns a certificate signed by the parent, or a self-signed CA certificate if parent is nil.
+func newCert(t *testing.T, name string, parentKey *ecdsa.PrivateKey, parent *x509.Certificate) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+}
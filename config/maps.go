@@ -0,0 +1,83 @@
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// setPath sets val at the dotted key of m, creating the nested maps on demand.
+func setPath(m map[string]interface{}, key string, val interface{}) {
+	path := strings.Split(strings.ToLower(key), ".")
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[k] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = val
+}
+
+// getPath returns the value at the dotted key of m.
+func getPath(m map[string]interface{}, key string) (val interface{}, ok bool) {
+	path := strings.Split(strings.ToLower(key), ".")
+	for _, k := range path[:len(path)-1] {
+		if m, ok = m[k].(map[string]interface{}); !ok {
+			return
+		}
+	}
+	val, ok = m[path[len(path)-1]]
+	return
+}
+
+// deletePath removes the value at the dotted key of m.
+func deletePath(m map[string]interface{}, key string) {
+	path := strings.Split(strings.ToLower(key), ".")
+	for _, k := range path[:len(path)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, path[len(path)-1])
+}
+
+// conflict returns the first dotted key of src that is a map in one of dst and src and a value in the other.
+func conflict(dst, src map[string]interface{}) (key string, ok bool) {
+	keys := make([]string, 0, len(src))
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		dv, sv := dst[strings.ToLower(k)], src[k]
+		if dv == nil || sv == nil || sv == Tombstone || k == MergeDirective {
+			continue
+		}
+		dm, dIsMap := toMap(dv)
+		sm, sIsMap := toMap(sv)
+		switch {
+		case dIsMap && sIsMap:
+			if key, ok = conflict(dm, sm); ok {
+				return strings.ToLower(k) + "." + key, true
+			}
+		case dIsMap != sIsMap:
+			return strings.ToLower(k), true
+		}
+	}
+	return
+}
+
+// toMap returns the nested settings of v if it is a map.
+func toMap(v interface{}) (map[string]interface{}, bool) {
+	switch v.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+		return cast.ToStringMap(v), true
+	default:
+		return nil, false
+	}
+}
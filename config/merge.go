@@ -0,0 +1,247 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// Merge strategies of the lists.
+const (
+	MergeReplace = "replace" // the later list replaces the earlier one.
+	MergeAppend  = "append"  // the later items are appended to the earlier ones.
+	MergeUnion   = "union"   // the items are merged by UnionKey, or deduplicated if they are not maps.
+)
+
+// Directives in the config documents.
+const (
+	// MergeDirective maps the keys of the sibling lists to their strategies for merging the document, e.g.
+	//   cors:
+	//     $merge: {allowed_origins: union}
+	//     allowed_origins: [https://example.com]
+	// The strategy of a union by key is `union:<key>`.
+	MergeDirective = "$merge"
+	// Tombstone deletes the merged key if it is the value, e.g. `cors: $delete`, or deletes the
+	// merged item of a union by key if it is true in the item, e.g. `{name: a, $delete: true}`.
+	Tombstone = "$delete"
+)
+
+// defaultUnionKey identifies the items of a union by key.
+const defaultUnionKey = "name"
+
+type MergeOption struct {
+	Key      string // the dotted config key of the list, e.g. `cors.allowed_origins`.
+	Strategy string // replace/append/union. Default: "replace"
+	UnionKey string // the item key identifying the maps of a union. Default: "name"
+}
+
+// mergeStrategy is the strategy of a list.
+type mergeStrategy struct {
+	mode     string
+	unionKey string
+}
+
+// parseStrategy parses `replace`, `append`, `union` or `union:<key>`.
+func parseStrategy(s string) (st mergeStrategy, err error) {
+	st.mode = s
+	if i := strings.Index(s, ":"); i >= 0 {
+		st.mode, st.unionKey = s[:i], s[i+1:]
+	}
+	st = newStrategy(st.mode, st.unionKey)
+	err = st.check()
+	return
+}
+
+func newStrategy(mode, unionKey string) mergeStrategy {
+	st := mergeStrategy{
+		mode:     strings.ToLower(strings.TrimSpace(mode)),
+		unionKey: strings.ToLower(strings.TrimSpace(unionKey)),
+	}
+	if st.mode == "" {
+		st.mode = MergeReplace
+	}
+	if st.mode == MergeUnion && st.unionKey == "" {
+		st.unionKey = defaultUnionKey
+	}
+	return st
+}
+
+func (st mergeStrategy) check() error {
+	switch {
+	case st.mode == MergeUnion,
+		(st.mode == MergeReplace || st.mode == MergeAppend) && st.unionKey == "":
+		return nil
+	}
+	return failure.New(liberrors.ErrConfigParseFailed,
+		failure.Message("Invalid merge strategy"),
+		failure.Context{"strategy": st.mode, "union_key": st.unionKey},
+	)
+}
+
+// merge returns the merged config of v and the settings by the strategies.
+// A key must not be a map in one of them and a value in the other.
+func (o option) merge(v *viper.Viper, settings map[string]interface{}, fctx failure.Context) (merged *viper.Viper, err error) {
+	dst := v.AllSettings()
+	if key, ok := conflict(dst, settings); ok {
+		err = failure.New(liberrors.ErrConfigMergeConflict,
+			failure.Message("Config key is both a map and a value"),
+			fctx,
+			failure.Context{"key": key},
+		)
+		return
+	}
+	if err = mergeMaps(dst, settings, "", o.strategies); err != nil {
+		err = failure.Wrap(err, fctx)
+		return
+	}
+	merged = viper.New()
+	if err = merged.MergeConfigMap(dst); err != nil {
+		err = failure.Translate(err, liberrors.ErrConfigMergeConflict, fctx)
+	}
+	return
+}
+
+// mergeMaps merges src into dst. The directives and tombstones of src are applied and not merged.
+func mergeMaps(dst, src map[string]interface{}, prefix string, strategies map[string]mergeStrategy) error {
+	directives := make(map[string]mergeStrategy)
+	for k, val := range cast.ToStringMapString(src[MergeDirective]) {
+		st, err := parseStrategy(val)
+		if err != nil {
+			return failure.Wrap(err, failure.Context{"key": joinKey(prefix, k)})
+		}
+		directives[strings.ToLower(k)] = st
+	}
+
+	for k, sv := range src {
+		key := strings.ToLower(k)
+		path := joinKey(prefix, key)
+		if key == MergeDirective || key == Tombstone {
+			continue
+		}
+		if sv == Tombstone {
+			delete(dst, key)
+			continue
+		}
+		if _, ok := dst[key]; ok && sv == nil {
+			continue
+		}
+
+		if sm, ok := toMap(sv); ok {
+			dm, ok := toMap(dst[key])
+			if !ok {
+				dm = make(map[string]interface{})
+			}
+			if err := mergeMaps(dm, sm, path, strategies); err != nil {
+				return err
+			}
+			dst[key] = dm
+			continue
+		}
+
+		st, ok := directives[key]
+		if !ok {
+			st = strategies[path]
+		}
+		dl, dIsList := dst[key].([]interface{})
+		sl, sIsList := sv.([]interface{})
+		// the union resolves the tombstones of the items even if there is no earlier list.
+		if !sIsList || (!dIsList && st.mode != MergeUnion) {
+			dst[key] = sv
+			continue
+		}
+		switch st.mode {
+		case MergeAppend:
+			dst[key] = append(append([]interface{}{}, dl...), sl...)
+		case MergeUnion:
+			merged, err := union(dl, sl, path, st.unionKey, strategies)
+			if err != nil {
+				return err
+			}
+			dst[key] = merged
+		default:
+			dst[key] = sv
+		}
+	}
+	return nil
+}
+
+// union merges the items of src into dst. The maps are identified by the union key,
+// and the other items are appended unless dst has an equal one.
+func union(dst, src []interface{}, path, unionKey string, strategies map[string]mergeStrategy) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(dst)+len(src))
+	for _, item := range dst {
+		if m, ok := toMap(item); ok {
+			item = m
+		}
+		out = append(out, item)
+	}
+	for _, item := range src {
+		sm, ok := toMap(item)
+		if !ok {
+			if indexOf(out, item) < 0 {
+				out = append(out, item)
+			}
+			continue
+		}
+
+		id, hasID := sm[unionKey]
+		i := -1
+		if hasID {
+			i = indexOfKey(out, unionKey, id)
+		}
+		switch {
+		case cast.ToBool(sm[Tombstone]):
+			if i >= 0 {
+				out = append(out[:i:i], out[i+1:]...)
+			}
+		case i >= 0:
+			dm := out[i].(map[string]interface{})
+			merged := make(map[string]interface{}, len(dm))
+			for k, v := range dm {
+				merged[k] = v
+			}
+			if err := mergeMaps(merged, sm, path, strategies); err != nil {
+				return nil, err
+			}
+			out[i] = merged
+		default:
+			merged := make(map[string]interface{}, len(sm))
+			if err := mergeMaps(merged, sm, path, strategies); err != nil {
+				return nil, err
+			}
+			out = append(out, merged)
+		}
+	}
+	return out, nil
+}
+
+// indexOf returns the index of the item equal to v, or -1.
+func indexOf(items []interface{}, v interface{}) int {
+	for i := range items {
+		if reflect.DeepEqual(items[i], v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOfKey returns the index of the map whose key is id, or -1.
+func indexOfKey(items []interface{}, key string, id interface{}) int {
+	for i := range items {
+		if m, ok := toMap(items[i]); ok && cast.ToString(m[key]) == cast.ToString(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeStrategies(t *testing.T) {
+	base := `
+cors:
+  allowed_origins: [https://a.example.com]
+  debug: true
+servers:
+  - {name: a, port: 1}
+  - {name: b, port: 2}
+plugins: [p1, p2]
+removed:
+  key: 1
+`
+	tests := []struct {
+		name    string
+		opts    []Option
+		overlay string
+		want    map[string]interface{}
+	}{
+		{
+			name:    "replace by default",
+			overlay: "cors:\n  allowed_origins: [https://b.example.com]\nplugins: [p3]\n",
+			want: map[string]interface{}{
+				"cors.allowed_origins": []interface{}{"https://b.example.com"},
+				"cors.debug":           true,
+				"plugins":              []interface{}{"p3"},
+			},
+		},
+		{
+			name: "append by option",
+			opts: []Option{
+				WithMergeStrategy(MergeOption{Key: "CORS.Allowed_Origins", Strategy: MergeAppend}),
+			},
+			overlay: "cors:\n  allowed_origins: [https://a.example.com, https://b.example.com]\n",
+			want: map[string]interface{}{
+				"cors.allowed_origins": []interface{}{"https://a.example.com", "https://a.example.com", "https://b.example.com"},
+			},
+		},
+		{
+			name:    "union by directive",
+			overlay: "$merge: {plugins: union}\nplugins: [p2, p3]\ncors:\n  $merge: {allowed_origins: union}\n  allowed_origins: [https://a.example.com, https://b.example.com]\n",
+			want: map[string]interface{}{
+				"cors.allowed_origins": []interface{}{"https://a.example.com", "https://b.example.com"},
+				"plugins":              []interface{}{"p1", "p2", "p3"},
+				"$merge":               nil,
+				"cors.$merge":          nil,
+			},
+		},
+		{
+			name: "union by key",
+			opts: []Option{
+				WithMergeStrategy(MergeOption{Key: "servers", Strategy: MergeUnion}),
+			},
+			overlay: "servers:\n  - {name: b, port: 3}\n  - {name: c, port: 4}\n  - {name: a, $delete: true}\n",
+			want: map[string]interface{}{
+				"servers": []interface{}{
+					map[string]interface{}{"name": "b", "port": 3},
+					map[string]interface{}{"name": "c", "port": 4},
+				},
+			},
+		},
+		{
+			name: "union without earlier list",
+			opts: []Option{
+				WithMergeStrategy(MergeOption{Key: "extras", Strategy: MergeUnion}),
+			},
+			overlay: "extras:\n  - {name: a}\n  - {name: b, $delete: true}\n",
+			want: map[string]interface{}{
+				"extras": []interface{}{
+					map[string]interface{}{"name": "a"},
+				},
+			},
+		},
+		{
+			name: "directive overrides option",
+			opts: []Option{
+				WithMergeStrategy(MergeOption{Key: "servers", Strategy: MergeAppend}),
+			},
+			overlay: "$merge: {servers: \"union:port\"}\nservers:\n  - {name: c, port: 2}\n",
+			want: map[string]interface{}{
+				"servers": []interface{}{
+					map[string]interface{}{"name": "a", "port": 1},
+					map[string]interface{}{"name": "c", "port": 2},
+				},
+			},
+		},
+		{
+			name:    "tombstone",
+			overlay: "removed: $delete\ncors:\n  debug: $delete\n",
+			want: map[string]interface{}{
+				"removed":    nil,
+				"cors.debug": nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "00-base.yaml"), []byte(base), 0o600))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "10-overlay.yaml"), []byte(tt.overlay), 0o600))
+
+			conf, err := Init(append([]Option{WithBatchFiles(BatchFileOption{Directory: dir})}, tt.opts...)...)
+			require.NoError(t, err)
+			for key, want := range tt.want {
+				require.Equal(t, want, conf.Get(key), key)
+			}
+		})
+	}
+}
+
+func TestMergeStrategyInvalid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("x: 1\n"), 0o600))
+
+	_, err := Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithMergeStrategy(MergeOption{Key: "x", Strategy: "prepend"}),
+	)
+	require.True(t, failure.Is(err, liberrors.ErrConfigParseFailed))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("$merge: {x: \"append:id\"}\nx: [1]\n"), 0o600))
+	_, err = Init(WithLocalFile(LocalOption{Directory: dir}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigParseFailed))
+}
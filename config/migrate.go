@@ -0,0 +1,421 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/spf13/afero"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// VersionKey is the key of the config document version.
+// A document without version is version 1.
+const VersionKey = "version"
+
+// Migration upgrades the config document from version From to From+1.
+// The document keys are lowercase as read by Init.
+// The migrations also run on the tenant overlays carrying a version, which hold a part of the document.
+type Migration struct {
+	From    int
+	Migrate func(doc map[string]interface{}) error
+}
+
+// Migrate upgrades the config document to the latest version by running the
+// migrations in order, and sets the version of the document.
+// The document newer than the migrations is left as is.
+func Migrate(doc map[string]interface{}, ms ...Migration) (err error) {
+	steps := make(map[int]func(map[string]interface{}) error, len(ms))
+	for _, m := range ms {
+		if _, ok := steps[m.From]; ok {
+			return failure.New(liberrors.ErrConfigMigrationFailed,
+				failure.Message("Duplicated migration"),
+				failure.Context{"from": cast.ToString(m.From)},
+			)
+		}
+		steps[m.From] = m.Migrate
+	}
+
+	version := 1
+	if val, ok := doc[VersionKey]; ok {
+		if version, err = cast.ToIntE(val); err != nil {
+			return failure.Translate(err, liberrors.ErrConfigMigrationFailed,
+				failure.Message("Invalid config version"),
+			)
+		}
+	}
+	for {
+		step, ok := steps[version]
+		if !ok {
+			break
+		}
+		if err = step(doc); err != nil {
+			return failure.Translate(err, liberrors.ErrConfigMigrationFailed,
+				failure.Context{
+					"from": cast.ToString(version),
+					"to":   cast.ToString(version + 1),
+				},
+			)
+		}
+		version++
+		doc[VersionKey] = version
+	}
+	return nil
+}
+
+// MigrateDocument upgrades the config document encoded in the config type to
+// the latest version and returns it encoded in the same type.
+// It is used by the tools rewriting the stored payloads. The yaml and json documents
+// keep the case and order of their keys and the yaml comments, only the values changed
+// by the migrations are rewritten. The documents of the other types are re-encoded
+// with lowercase keys.
+func MigrateDocument(data []byte, format string, ms ...Migration) (out []byte, err error) {
+	doc, err := Decode(data, format)
+	if err != nil {
+		err = failure.Translate(err, liberrors.ErrConfigMigrationFailed)
+		return
+	}
+	if err = Migrate(doc, ms...); err != nil {
+		return
+	}
+	if f, ok := formats[format]; ok {
+		format = f
+	}
+	switch format {
+	case "yaml", "json":
+		out, err = rewrite(data, format, doc)
+	default:
+		out, err = encode(doc, format)
+	}
+	return
+}
+
+// rewrite returns the yaml or json document patched to the settings.
+// The json document is parsed as yaml, which is a superset of json.
+func rewrite(data []byte, format string, settings map[string]interface{}) (out []byte, err error) {
+	fctx := failure.Context{"type": format}
+	var root yaml.Node
+	if err = yaml.Unmarshal(data, &root); err != nil {
+		err = failure.Wrap(err, fctx)
+		return
+	}
+	node := &root
+	if root.Kind == yaml.DocumentNode && len(root.Content) == 1 {
+		node = root.Content[0]
+	}
+	versioned := hasNodeKey(node, VersionKey)
+	if node, err = patchNode(node, settings); err != nil {
+		err = failure.Wrap(err, fctx)
+		return
+	}
+	// the version added by the migrations leads the document.
+	if n := len(node.Content); !versioned && node.Kind == yaml.MappingNode && n > 2 && node.Content[n-2].Value == VersionKey {
+		first := node.Content[0]
+		node.Content[n-2].HeadComment, first.HeadComment = first.HeadComment, ""
+		node.Content = append(node.Content[n-2:], node.Content[:n-2]...)
+	}
+	if root.Kind == yaml.DocumentNode && len(root.Content) == 1 {
+		root.Content[0] = node
+		node = &root
+	}
+
+	var buf bytes.Buffer
+	if format == "json" {
+		if err = writeJSON(&buf, node); err != nil {
+			err = failure.Wrap(err, fctx)
+			return
+		}
+		var indented bytes.Buffer
+		if err = json.Indent(&indented, buf.Bytes(), "", "  "); err != nil {
+			err = failure.Wrap(err, fctx)
+			return
+		}
+		indented.WriteByte('\n')
+		out = indented.Bytes()
+		return
+	}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err = enc.Encode(node); err != nil {
+		err = failure.Wrap(err, fctx)
+		return
+	}
+	if err = enc.Close(); err != nil {
+		err = failure.Wrap(err, fctx)
+		return
+	}
+	out = buf.Bytes()
+	return
+}
+
+// patchNode returns the node of the value, reusing the nodes whose values are unchanged.
+// The keys are matched case-insensitively, as the migrations see the lowercase keys,
+// and the keys added by the migrations are appended in order.
+func patchNode(n *yaml.Node, v interface{}) (*yaml.Node, error) {
+	if sameValue(n, v) {
+		return n, nil
+	}
+	if m, ok := toMap(v); ok && n.Kind == yaml.MappingNode {
+		patched := *n
+		patched.Content = nil
+		seen := make(map[string]bool, len(m))
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := strings.ToLower(n.Content[i].Value)
+			val, ok := m[key]
+			if !ok || seen[key] {
+				continue
+			}
+			seen[key] = true
+			node, err := patchNode(n.Content[i+1], val)
+			if err != nil {
+				return nil, err
+			}
+			patched.Content = append(patched.Content, n.Content[i], node)
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			if !seen[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			node, err := newNode(m[k])
+			if err != nil {
+				return nil, err
+			}
+			patched.Content = append(patched.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, node)
+		}
+		return &patched, nil
+	}
+	if items, ok := v.([]interface{}); ok && n.Kind == yaml.SequenceNode && len(items) == len(n.Content) {
+		patched := *n
+		patched.Content = make([]*yaml.Node, len(items))
+		for i := range items {
+			node, err := patchNode(n.Content[i], items[i])
+			if err != nil {
+				return nil, err
+			}
+			patched.Content[i] = node
+		}
+		return &patched, nil
+	}
+	node, err := newNode(v)
+	if err != nil {
+		return nil, err
+	}
+	node.HeadComment, node.LineComment, node.FootComment = n.HeadComment, n.LineComment, n.FootComment
+	return node, nil
+}
+
+// hasNodeKey reports whether the mapping node has the key under case-folding.
+func hasNodeKey(n *yaml.Node, key string) bool {
+	if n.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if strings.EqualFold(n.Content[i].Value, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// newNode returns the node of the value.
+func newNode(v interface{}) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(canonical(v)); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// sameValue reports whether the node decodes to the value, ignoring the case of the keys
+// and the type of the numbers.
+func sameValue(n *yaml.Node, v interface{}) bool {
+	var decoded interface{}
+	if err := n.Decode(&decoded); err != nil {
+		return false
+	}
+	a, err := json.Marshal(lowerKeys(canonical(decoded)))
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(lowerKeys(canonical(v)))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
+}
+
+// lowerKeys returns the canonical value with the lowercase keys.
+func lowerKeys(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[strings.ToLower(k)] = lowerKeys(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i := range val {
+			out[i] = lowerKeys(val[i])
+		}
+		return out
+	}
+	return v
+}
+
+// writeJSON writes the node in json, keeping the order of the keys.
+func writeJSON(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSON(buf, n.Content[0])
+	case yaml.AliasNode:
+		return writeJSON(buf, n.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(n.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err = writeJSON(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, n.Content[i]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return err
+	}
+	data, err := json.Marshal(canonical(v))
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+// encode encodes the settings in the config type.
+func encode(settings map[string]interface{}, format string) (data []byte, err error) {
+	fs := afero.NewMemMapFs()
+	v := viper.New()
+	v.SetFs(fs)
+	v.SetConfigType(format)
+	if err = v.MergeConfigMap(settings); err != nil {
+		err = failure.Wrap(err, failure.Context{"type": format})
+		return
+	}
+	if err = v.WriteConfigAs("/config"); err != nil {
+		err = failure.Wrap(err, failure.Context{"type": format})
+		return
+	}
+	data, err = afero.ReadFile(fs, "/config")
+	return
+}
+
+// migrate upgrades the merged config and the tenant overlays.
+// The overlays without version are not migrated, and the version of the base config is kept.
+func (s *snapshot) migrate(o option) (err error) {
+	doc := s.v.AllSettings()
+	if err = Migrate(doc, o.migrations...); err != nil {
+		return
+	}
+	s.v = viper.New()
+	if err = s.v.MergeConfigMap(doc); err != nil {
+		return
+	}
+	for id, overlays := range s.overlays {
+		for _, overlay := range overlays {
+			if _, ok := overlay[VersionKey]; !ok {
+				continue
+			}
+			if err = Migrate(overlay, o.migrations...); err != nil {
+				err = failure.Wrap(err, failure.Context{"tenant": id})
+				return
+			}
+			delete(overlay, VersionKey)
+		}
+	}
+	return
+}
+
+// MigrateCommand runs the migrate subcommand of the application, e.g. `app config-migrate -o config.v3.yaml config.yaml`.
+// It reads the document from the file argument or stdin, and writes the upgraded document to stdout unless -o is set.
+func MigrateCommand(args []string, ms ...Migration) error {
+	fs := flag.NewFlagSet("config-migrate", flag.ContinueOnError)
+	ftype := fs.String("type", "", "config type of the document, default inferred from the file extension")
+	output := fs.String("o", "", "output file, default stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	switch input := fs.Arg(0); input {
+	case "", "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		if *ftype == "" {
+			*ftype, _ = formatOf(input)
+		}
+		data, err = os.ReadFile(input)
+		if err != nil {
+			return fileError(err, input)
+		}
+	}
+	if err != nil {
+		return failure.Wrap(err)
+	}
+	if *ftype == "" {
+		return failure.New(liberrors.ErrConfigMigrationFailed, failure.Message("Config type is required"))
+	}
+
+	out, err := MigrateDocument(data, *ftype, ms...)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = os.Stdout.Write(out)
+		return failure.Wrap(err)
+	}
+	if err = os.WriteFile(*output, out, 0o600); err != nil {
+		return failure.Wrap(err, failure.Context{"output": *output})
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+var testMigrations = []Migration{
+	{
+		From: 1,
+		Migrate: func(doc map[string]interface{}) error {
+			if val, ok := getPath(doc, "db.addr"); ok {
+				deletePath(doc, "db.addr")
+				setPath(doc, "database.host", val)
+			}
+			return nil
+		},
+	},
+	{
+		From: 2,
+		Migrate: func(doc map[string]interface{}) error {
+			if val, ok := getPath(doc, "database.host"); ok {
+				setPath(doc, "database.addrs", []interface{}{val})
+				deletePath(doc, "database.host")
+			}
+			return nil
+		},
+	},
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  map[string]interface{}
+		ms   []Migration
+		want map[string]interface{}
+
+		assertion require.ErrorAssertionFunc
+	}{
+		{
+			name: "no version",
+			doc:  map[string]interface{}{"db": map[string]interface{}{"addr": "a"}},
+			ms:   testMigrations,
+			want: map[string]interface{}{
+				"db":       map[string]interface{}{},
+				"database": map[string]interface{}{"addrs": []interface{}{"a"}},
+				"version":  3,
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "version 2",
+			doc: map[string]interface{}{
+				"database": map[string]interface{}{"host": "a"},
+				"version":  "2",
+			},
+			ms: testMigrations,
+			want: map[string]interface{}{
+				"database": map[string]interface{}{"addrs": []interface{}{"a"}},
+				"version":  3,
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "newer version",
+			doc:  map[string]interface{}{"version": 5},
+			ms:   testMigrations,
+			want: map[string]interface{}{"version": 5},
+
+			assertion: require.NoError,
+		},
+		{
+			name:      "invalid version",
+			doc:       map[string]interface{}{"version": "v1"},
+			ms:        testMigrations,
+			assertion: require.Error,
+		},
+		{
+			name:      "duplicated migration",
+			doc:       map[string]interface{}{},
+			ms:        append(testMigrations, Migration{From: 1}),
+			assertion: require.Error,
+		},
+		{
+			name: "failed migration",
+			doc:  map[string]interface{}{},
+			ms: []Migration{
+				{
+					From: 1,
+					Migrate: func(doc map[string]interface{}) error {
+						return errors.New("failed")
+					},
+				},
+			},
+			assertion: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Migrate(tt.doc, tt.ms...)
+			tt.assertion(t, err)
+			if err != nil {
+				require.True(t, failure.Is(err, liberrors.ErrConfigMigrationFailed))
+				return
+			}
+			require.Equal(t, tt.want, tt.doc)
+		})
+	}
+}
+
+func TestWithMigrations(t *testing.T) {
+	conf, err := Init(
+		WithLocalFile(LocalOption{
+			Directory: "./testfixtures/",
+			Filename:  "local",
+		}),
+		WithMigrations(Migration{
+			From: 1,
+			Migrate: func(doc map[string]interface{}) error {
+				val, _ := getPath(doc, "a.b.c")
+				setPath(doc, "a.b.e", val)
+				return nil
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	var c struct {
+		Version int
+		A       struct {
+			B struct {
+				E string
+			}
+		}
+	}
+	require.NoError(t, conf.Unmarshal(&c))
+	require.Equal(t, 2, c.Version)
+	require.Equal(t, "1", c.A.B.E)
+}
+
+func TestMigrateDocument(t *testing.T) {
+	out, err := MigrateDocument([]byte("db:\n  addr: a\n"), "yml", testMigrations...)
+	require.NoError(t, err)
+
+	doc, err := Decode(out, "yaml")
+	require.NoError(t, err)
+	require.Equal(t, 3, doc[VersionKey])
+	addrs, _ := getPath(doc, "database.addrs")
+	require.Equal(t, []interface{}{"a"}, addrs)
+
+	out, err = MigrateDocument([]byte("# service\ndb:\n  addr: a # primary\n  Pool: {Max: 2}\nheaders:\n  X-Request-Id: abc\n"), "yaml", testMigrations...)
+	require.NoError(t, err)
+	require.Equal(t, "# service\nversion: 3\ndb:\n  Pool: {Max: 2}\nheaders:\n  X-Request-Id: abc\ndatabase:\n  addrs:\n    - a\n", string(out),
+		"the keys, order and comments are kept")
+
+	out, err = MigrateDocument([]byte(`{"version": 2, "headers": {"X-Request-Id": "abc"}, "database": {"host": "a", "port": 1.5}}`), "json", testMigrations...)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version": 3, "headers": {"X-Request-Id": "abc"}, "database": {"port": 1.5, "addrs": ["a"]}}`, string(out))
+	require.Regexp(t, `(?s)"version".*"headers".*"database".*"port".*"addrs"`, string(out), "the order of the keys is kept")
+
+	_, err = MigrateDocument([]byte("db: ["), "yaml", testMigrations...)
+	require.True(t, failure.Is(err, liberrors.ErrConfigMigrationFailed))
+}
+
+func TestWithMigrations_Tenants(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("version: 3\ndatabase:\n  addrs: [a]\n"), 0o600))
+	tenants := t.TempDir()
+	for tenant, overlay := range map[string]string{
+		"acme":   "version: 1\ndb:\n  addr: b\n",
+		"globex": "db:\n  addr: c\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(tenants, tenant), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(tenants, tenant, "config.yaml"), []byte(overlay), 0o600))
+	}
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithTenantFiles(TenantFileOption{Directory: tenants}),
+		WithMigrations(testMigrations...),
+	)
+	require.NoError(t, err)
+
+	ctx := func(tenant string) context.Context {
+		return xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.TenantKey, tenant))
+	}
+	acme := conf.Tenant(ctx("acme"))
+	require.Equal(t, []interface{}{"b"}, acme.Get("database.addrs"), "the overlay is migrated")
+	require.Equal(t, 3, acme.Get(VersionKey), "the overlay does not reset the version")
+	globex := conf.Tenant(ctx("globex"))
+	require.Equal(t, "c", globex.Get("db.addr"), "the overlay without version is not migrated")
+	require.Equal(t, []interface{}{"a"}, globex.Get("database.addrs"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(tenants, "acme", "config.yaml"), []byte("version: x\n"), 0o600))
+	_, err = Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithTenantFiles(TenantFileOption{Directory: tenants}),
+		WithMigrations(testMigrations...),
+	)
+	require.True(t, failure.Is(err, liberrors.ErrConfigMigrationFailed), err)
+}
+
+func TestMigrateCommand(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "config.yaml")
+	output := filepath.Join(dir, "config.v3.yaml")
+	require.NoError(t, os.WriteFile(input, []byte("db:\n  addr: a\n"), 0o600))
+
+	require.NoError(t, MigrateCommand([]string{"-o", output, input}, testMigrations...))
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	doc, err := Decode(data, "yaml")
+	require.NoError(t, err)
+	require.Equal(t, 3, doc[VersionKey])
+
+	err = MigrateCommand([]string{filepath.Join(dir, "missing.yaml")}, testMigrations...)
+	require.True(t, failure.Is(err, liberrors.ErrConfigFileNotFound), err)
+	noext := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(noext, []byte("db:\n  addr: a\n"), 0o600))
+	err = MigrateCommand([]string{noext}, testMigrations...)
+	require.True(t, failure.Is(err, liberrors.ErrConfigMigrationFailed), "config type is required")
+	require.NoError(t, MigrateCommand([]string{"-type", "yaml", "-o", output, noext}, testMigrations...))
+}
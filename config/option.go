@@ -1,78 +1,156 @@
 package config
 
+import (
+	"flag"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
 type Option func(o *option)
 
 type option struct {
-	localEnable bool
-	localDir    string
-	localName   string
-	localType   string
+	locals []localFile
 
 	remoteEnable   bool
+	remoteOptional bool
+	remoteWatch    bool
 	remoteDriver   string
 	remoteEndpoint string
 	remotePath     string
 	remoteType     string
+
+	tenantLocalEnable bool
+	tenantDir         string
+	tenantName        string
+	tenantType        string
+
+	tenantRemoteEnable bool
+	tenantEndpoint     string
+	tenantPrefix       string
+	tenantRemoteName   string
+	tenantRemoteType   string
+
+	envEnable bool
+	envPrefix string
+
+	pflags  []*pflag.FlagSet
+	goflags []*flag.FlagSet
+
+	aliases *aliases
+
+	strategies map[string]mergeStrategy
+
+	verifier *verifier
+
+	selector map[string]string
+
+	accessTracking bool
+
+	migrations []Migration
+
+	audit *auditor
+
+	asDefault bool
+
+	sources []Source
+
+	validators    []func(Config) error
+	reloadSignals []os.Signal
+	reloadQuiet   time.Duration
+	reloadMaxWait time.Duration
+}
+
+// localFile is a local file, or a batch directory if name is empty.
+type localFile struct {
+	dir      string
+	name     string
+	ftype    string
+	optional bool
+	watch    bool
+}
+
+// enabled reports whether any config source is enabled.
+func (o option) enabled() bool {
+	return len(o.locals) > 0 || o.remoteEnable || o.tenantLocalEnable || o.tenantRemoteEnable ||
+		o.envEnable || len(o.pflags) > 0 || len(o.goflags) > 0 || len(o.sources) > 0
+}
+
+// remoteSource returns the name of the remote source.
+func (o option) remoteSource() string {
+	return o.remoteDriver + "://" + o.remoteEndpoint + "/" + o.remotePath
 }
 
 type LocalOption struct {
 	Directory string // Directory of the local file. Default: "./etc/conf/"
 	Filename  string // Filename without ext. Default: "config"
-	Type      string // File type of the local file(yaml/toml/json). Default: "yaml"
+	Type      string // File type of the local file(yaml/toml/json/hcl/ini/dotenv/properties). Default: inferred from the file extension
+	Optional  bool   // Skip the file if it does not exist, e.g. the developer overrides in `config.local.yaml`.
+	Watch     bool   // Reload the config when the file changes. The directory missing at Init is not watched.
 }
 
 // WithLocalFile sets the local file path.
 // dir: the directory of the local file.
 // name: the name of the local file without ext.
-// ftype: the file type of the local file. (yaml/toml/json)
+// ftype: the file type of the local file. (yaml/toml/json/hcl/ini/dotenv/properties)
+// The file is looked up by the extensions of the type, or all supported extensions if the type is empty.
+// The local files and batch files are merged in the order of the options.
 func WithLocalFile(opt LocalOption) Option {
 	return func(o *option) {
-		o.localEnable = true
 		if opt.Directory == "" {
 			opt.Directory = "./etc/conf/"
 		}
 		if opt.Filename == "" {
 			opt.Filename = "config"
 		}
-		if opt.Type == "" {
-			opt.Type = "yaml"
-		}
-		o.localDir = opt.Directory
-		o.localName = opt.Filename
-		o.localType = opt.Type
+		o.locals = append(o.locals, localFile{
+			dir:      opt.Directory,
+			name:     opt.Filename,
+			ftype:    opt.Type,
+			optional: opt.Optional,
+			watch:    opt.Watch,
+		})
 	}
 }
 
 // BatchedFilesOption is the option of the batch files.
 type BatchFileOption struct {
 	Directory string // Directory of the local file. Default: "./etc/conf/"
-	Type      string // File type of the local file(yaml/toml/json). Default: "yaml"
+	Type      string // Only load the files of the type(yaml/toml/json/hcl/ini/dotenv/properties). Default: all supported types
+	Optional  bool   // Skip the directory if it does not exist.
+	Watch     bool   // Reload the config when the files in the directory change. The directory missing at Init is not watched.
 }
 
 // WithBatchFiles sets the batch files. Using lexical order to load the files and merge them.
+// The type of each file is inferred from its extension, the files of unsupported types are skipped.
 func WithBatchFiles(opt BatchFileOption) Option {
 	return func(o *option) {
 		if opt.Directory == "" {
 			opt.Directory = "./etc/conf/"
 		}
-		if opt.Type == "" {
-			opt.Type = "yaml"
-		}
-		o.localEnable = true
-		o.localDir = opt.Directory
-		o.localType = opt.Type
+		o.locals = append(o.locals, localFile{
+			dir:      opt.Directory,
+			ftype:    opt.Type,
+			optional: opt.Optional,
+			watch:    opt.Watch,
+		})
 	}
 }
 
 type ConsulOption struct {
 	Endpoint string // the consul endpoint url. Default: "localhost:8500"
 	Path     string // the consul key. Default: "SERVICE_CONFIG"
-	Type     string // the file type of the remote config(yaml/toml/json). Default: "yaml"
+	Type     string // the file type of the remote config(yaml/toml/json/hcl/ini/dotenv/properties). Default: "yaml"
+	Optional bool   // Skip the key if it does not exist. The unreachable consul still fails.
+	Watch    bool   // Reload the config when the key changes, by the consul blocking queries.
 }
 
 // WithConsul sets the consul remote config.
 // url: the consul url.
-// ftype: the file type of the remote config. (yaml/toml/json)
+// ftype: the file type of the remote config. (yaml/toml/json/hcl/ini/dotenv/properties)
 func WithConsul(opt ConsulOption) Option {
 	return func(o *option) {
 		if opt.Endpoint == "" {
@@ -85,9 +163,228 @@ func WithConsul(opt ConsulOption) Option {
 			opt.Type = "yaml"
 		}
 		o.remoteEnable = true
+		o.remoteOptional = opt.Optional
+		o.remoteWatch = opt.Watch
 		o.remoteDriver = "consul"
 		o.remoteEndpoint = opt.Endpoint
 		o.remotePath = opt.Path
 		o.remoteType = opt.Type
 	}
 }
+
+type TenantFileOption struct {
+	Directory string // Directory holding one sub-directory per tenant ID. Default: "./etc/conf/tenants/"
+	Filename  string // Filename without ext inside the tenant directory. Default: "config"
+	Type      string // File type of the tenant files(yaml/toml/json/hcl/ini/dotenv/properties). Default: inferred from the file extension
+}
+
+// WithTenantFiles sets the local tenant overlays.
+// The overlay of a tenant is read from `<Directory>/<tenant>/<Filename>.<Type>`.
+func WithTenantFiles(opt TenantFileOption) Option {
+	return func(o *option) {
+		if opt.Directory == "" {
+			opt.Directory = "./etc/conf/tenants/"
+		}
+		if opt.Filename == "" {
+			opt.Filename = "config"
+		}
+		o.tenantLocalEnable = true
+		o.tenantDir = opt.Directory
+		o.tenantName = opt.Filename
+		o.tenantType = opt.Type
+	}
+}
+
+type ConsulTenantOption struct {
+	Endpoint string // the consul endpoint url. Default: "localhost:8500"
+	Prefix   string // the consul key prefix of tenants. Default: "tenants"
+	Name     string // the consul key name under the tenant prefix. Default: "config"
+	Type     string // the file type of the remote config(yaml/toml/json/hcl/ini/dotenv/properties). Default: "yaml"
+}
+
+// WithConsulTenants sets the consul tenant overlays.
+// The overlay of a tenant is read from the key `<Prefix>/<tenant>/<Name>`.
+// The prefix without tenant keys is skipped, but the unreachable consul still fails.
+// It takes precedence over the local tenant overlays.
+func WithConsulTenants(opt ConsulTenantOption) Option {
+	return func(o *option) {
+		if opt.Endpoint == "" {
+			opt.Endpoint = "localhost:8500"
+		}
+		if opt.Prefix == "" {
+			opt.Prefix = "tenants"
+		}
+		if opt.Name == "" {
+			opt.Name = "config"
+		}
+		if opt.Type == "" {
+			opt.Type = "yaml"
+		}
+		o.tenantRemoteEnable = true
+		o.tenantEndpoint = opt.Endpoint
+		o.tenantPrefix = opt.Prefix
+		o.tenantRemoteName = opt.Name
+		o.tenantRemoteType = opt.Type
+	}
+}
+
+type EnvOption struct {
+	Prefix string // Prefix of the environment variables, e.g. `APP` reads `http.port` from `APP_HTTP_PORT`.
+}
+
+// WithEnv overrides the file and remote config with the environment variables.
+// Only the keys present in the config or registered as flags are looked up.
+func WithEnv(opt EnvOption) Option {
+	return func(o *option) {
+		o.envEnable = true
+		o.envPrefix = opt.Prefix
+	}
+}
+
+// WithFlags overrides the file, remote and environment config with the flags
+// explicitly set on the command line. The flag name is the dotted config key.
+func WithFlags(fs *pflag.FlagSet) Option {
+	return func(o *option) {
+		o.pflags = append(o.pflags, fs)
+	}
+}
+
+// WithGoFlags is the same as WithFlags for the standard library flag set.
+func WithGoFlags(fs *flag.FlagSet) Option {
+	return func(o *option) {
+		o.goflags = append(o.goflags, fs)
+	}
+}
+
+// WithAlias maps the deprecated key to the new key while merging the sources, e.g. `db.addr` to `database.host`.
+// A warning naming the source is logged the first time the source uses the deprecated key.
+func WithAlias(oldKey, newKey string) Option {
+	return func(o *option) {
+		if o.aliases == nil {
+			o.aliases = &aliases{}
+		}
+		o.aliases.keys = append(o.aliases.keys, alias{
+			old: strings.ToLower(oldKey),
+			new: strings.ToLower(newKey),
+		})
+	}
+}
+
+// WithMergeStrategy sets the merge strategy of the list at the key for all sources.
+// A `$merge` directive in a document takes precedence while merging the document.
+func WithMergeStrategy(opt MergeOption) Option {
+	return func(o *option) {
+		if o.strategies == nil {
+			o.strategies = make(map[string]mergeStrategy)
+		}
+		o.strategies[strings.ToLower(opt.Key)] = newStrategy(opt.Strategy, opt.UnionKey)
+	}
+}
+
+// WithSignature refuses to load the local files, consul keys and tenant overlays
+// unless their detached Ed25519 signatures are verified by any of the keys.
+func WithSignature(opt SignatureOption) Option {
+	return func(o *option) {
+		if opt.Suffix == "" {
+			opt.Suffix = ".sig"
+		}
+		o.verifier = &verifier{
+			keys:    opt.PublicKeys,
+			private: opt.PrivateKey,
+			suffix:  opt.Suffix,
+		}
+	}
+}
+
+// WithAccessTracking tracks the keys read by Get, UnmarshalKey and Unmarshal for Config.Usage.
+func WithAccessTracking() Option {
+	return func(o *option) {
+		o.accessTracking = true
+	}
+}
+
+// WithMigrations upgrades the merged config document and the tenant overlays to the latest version before they are used.
+func WithMigrations(ms ...Migration) Option {
+	return func(o *option) {
+		o.migrations = append(o.migrations, ms...)
+	}
+}
+
+type AuditOption struct {
+	Sink       AuditSink // Sink of the audit events. Default: LogSink
+	SecretKeys []string  // Patterns of the keys whose values are masked. Default: password, secret, token, etc.
+}
+
+// WithAudit emits the key-level changes of every reload to the audit sink.
+func WithAudit(opt AuditOption) Option {
+	return func(o *option) {
+		if opt.Sink == nil {
+			opt.Sink = LogSink{}
+		}
+		if len(opt.SecretKeys) == 0 {
+			opt.SecretKeys = defaultSecretKeys
+		}
+		keys := make([]string, len(opt.SecretKeys))
+		for i := range opt.SecretKeys {
+			keys[i] = strings.ToLower(opt.SecretKeys[i])
+		}
+		o.audit = &auditor{
+			sink:       opt.Sink,
+			secretKeys: keys,
+		}
+	}
+}
+
+// AsDefault sets the config returned by Init as the process-wide Default config.
+func AsDefault() Option {
+	return func(o *option) {
+		o.asDefault = true
+	}
+}
+
+// WithSource merges the custom source after the local and remote config.
+// The config reloads on the changes of the source if it implements Watcher.
+func WithSource(src Source) Option {
+	return func(o *option) {
+		o.sources = append(o.sources, src)
+	}
+}
+
+// WithValidator checks the merged config before it is used by Init and every reload.
+// The reload is rejected and the current config is kept if fn returns an error.
+func WithValidator(fn func(Config) error) Option {
+	return func(o *option) {
+		o.validators = append(o.validators, fn)
+	}
+}
+
+// WithReloadSignal reloads the config on the signals. Default: SIGHUP
+// The outcome of the reload is logged and the subscribers are notified on success.
+func WithReloadSignal(sigs ...os.Signal) Option {
+	return func(o *option) {
+		if len(sigs) == 0 {
+			sigs = []os.Signal{syscall.SIGHUP}
+		}
+		o.reloadSignals = append(o.reloadSignals, sigs...)
+	}
+}
+
+// WithReloadDebounce coalesces the reloads triggered by the watched sources and signals,
+// e.g. the local files and consul key with Watch set, and the polled custom sources.
+// The config reloads once after no trigger arrives for the quiet period, so a
+// burst of changes across the sources results in one merge and one notification.
+// The triggers arriving continuously still reload at least once per 10 quiet periods,
+// see WithReloadMaxWait.
+func WithReloadDebounce(quiet time.Duration) Option {
+	return func(o *option) {
+		o.reloadQuiet = quiet
+	}
+}
+
+// WithReloadMaxWait sets the longest delay of a debounced reload after the first coalesced trigger.
+// Default: 10 times the quiet period of WithReloadDebounce
+func WithReloadMaxWait(maxWait time.Duration) Option {
+	return func(o *option) {
+		o.reloadMaxWait = maxWait
+	}
+}
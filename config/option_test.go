@@ -21,10 +21,10 @@ func TestWithLocalFile(t *testing.T) {
 				opt: LocalOption{},
 			},
 			want: option{
-				localEnable: true,
-				localDir:    "./etc/conf/",
-				localName:   "config",
-				localType:   "yaml",
+				locals: []localFile{{
+					dir:  "./etc/conf/",
+					name: "config",
+				}},
 			},
 		},
 		{
@@ -37,10 +37,11 @@ func TestWithLocalFile(t *testing.T) {
 				},
 			},
 			want: option{
-				localEnable: true,
-				localDir:    "/etc/conf/",
-				localName:   "tmp_config",
-				localType:   "json",
+				locals: []localFile{{
+					dir:   "/etc/conf/",
+					name:  "tmp_config",
+					ftype: "json",
+				}},
 			},
 		},
 		{
@@ -52,10 +53,27 @@ func TestWithLocalFile(t *testing.T) {
 				},
 			},
 			want: option{
-				localEnable: true,
-				localDir:    "./etc/conf/",
-				localName:   "tmp_config",
-				localType:   "json",
+				locals: []localFile{{
+					dir:   "./etc/conf/",
+					name:  "tmp_config",
+					ftype: "json",
+				}},
+			},
+		},
+		{
+			name: "Optional file",
+			args: args{
+				opt: LocalOption{
+					Filename: "config.local",
+					Optional: true,
+				},
+			},
+			want: option{
+				locals: []localFile{{
+					dir:      "./etc/conf/",
+					name:     "config.local",
+					optional: true,
+				}},
 			},
 		},
 	}
@@ -147,9 +165,9 @@ func TestBatchFiles(t *testing.T) {
 				opt: BatchFileOption{},
 			},
 			want: option{
-				localEnable: true,
-				localDir:    "./etc/conf/",
-				localType:   "yaml",
+				locals: []localFile{{
+					dir: "./etc/conf/",
+				}},
 			},
 		},
 	}
@@ -161,3 +179,96 @@ func TestBatchFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestWithTenantFiles(t *testing.T) {
+	type args struct {
+		opt TenantFileOption
+	}
+	tests := []struct {
+		name string
+		args args
+		want option
+	}{
+		{
+			name: "Default value",
+			args: args{
+				opt: TenantFileOption{},
+			},
+			want: option{
+				tenantLocalEnable: true,
+				tenantDir:         "./etc/conf/tenants/",
+				tenantName:        "config",
+			},
+		},
+		{
+			name: "All custom value",
+			args: args{
+				opt: TenantFileOption{
+					Directory: "/etc/tenants/",
+					Filename:  "overlay",
+					Type:      "json",
+				},
+			},
+			want: option{
+				tenantLocalEnable: true,
+				tenantDir:         "/etc/tenants/",
+				tenantName:        "overlay",
+				tenantType:        "json",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got option
+			WithTenantFiles(tt.args.opt)(&got)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWithConsulTenants(t *testing.T) {
+	type args struct {
+		opt ConsulTenantOption
+	}
+	tests := []struct {
+		name string
+		args args
+		want option
+	}{
+		{
+			name: "Default value",
+			args: args{
+				opt: ConsulTenantOption{},
+			},
+			want: option{
+				tenantRemoteEnable: true,
+				tenantEndpoint:     "localhost:8500",
+				tenantPrefix:       "tenants",
+				tenantRemoteName:   "config",
+				tenantRemoteType:   "yaml",
+			},
+		},
+		{
+			name: "Optional custom value",
+			args: args{
+				opt: ConsulTenantOption{
+					Prefix: "svc/tenants",
+				},
+			},
+			want: option{
+				tenantRemoteEnable: true,
+				tenantEndpoint:     "localhost:8500",
+				tenantPrefix:       "svc/tenants",
+				tenantRemoteName:   "config",
+				tenantRemoteType:   "yaml",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got option
+			WithConsulTenants(tt.args.opt)(&got)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package config
+
+// SourceInfo is the provenance of a config source.
+type SourceInfo struct {
+	Name     string            `json:"name"` // the file path or the source name, e.g. `consul://localhost:8500/SERVICE_CONFIG`.
+	Optional bool              `json:"optional,omitempty"`
+	Skipped  bool              `json:"skipped,omitempty"`  // the optional source is not found.
+	Metadata map[string]string `json:"metadata,omitempty"` // the source details, e.g. the consul `index` or the git `commit`.
+}
+
+// record appends the provenance of a merged source.
+func (s *snapshot) record(info SourceInfo) {
+	s.sources = append(s.sources, info)
+}
+
+// skip records the optional source that is not found.
+func (s *snapshot) skip(name string) {
+	s.record(SourceInfo{
+		Name:     name,
+		Optional: true,
+		Skipped:  true,
+	})
+}
+
+func (c *config) Sources() []SourceInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	sources := make([]SourceInfo, len(c.snap.sources))
+	copy(sources, c.snap.sources)
+	return sources
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionalFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("x: 1\ny: 1\n"), 0o600))
+	missing := filepath.Join(dir, "conf.d")
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithLocalFile(LocalOption{Directory: dir, Filename: "config.local", Optional: true}),
+		WithBatchFiles(BatchFileOption{Directory: missing, Optional: true}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 1, conf.Get("x"))
+	require.Equal(t, []SourceInfo{
+		{Name: filepath.Join(dir, "config.yaml")},
+		{Name: filepath.Join(dir, "config.local.*"), Optional: true, Skipped: true},
+		{Name: missing, Optional: true, Skipped: true},
+	}, conf.Sources())
+
+	local := filepath.Join(dir, "config.local.yaml")
+	require.NoError(t, os.WriteFile(local, []byte("x: 2\n"), 0o600))
+	require.NoError(t, os.Mkdir(missing, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(missing, "a.yaml"), []byte("y: 3\n"), 0o600))
+	require.NoError(t, conf.Reload())
+	require.Equal(t, 2, conf.Get("x"))
+	require.Equal(t, 3, conf.Get("y"))
+	require.Equal(t, []SourceInfo{
+		{Name: filepath.Join(dir, "config.yaml")},
+		{Name: local, Optional: true},
+		{Name: filepath.Join(missing, "a.yaml"), Optional: true},
+	}, conf.Sources())
+
+	require.NoError(t, os.WriteFile(local, []byte("x: [\n"), 0o600))
+	err = conf.Reload()
+	require.True(t, failure.Is(err, liberrors.ErrConfigParseFailed), "parse errors of optional files fail")
+	require.Equal(t, 2, conf.Get("x"))
+
+	_, err = Init(WithLocalFile(LocalOption{Directory: local, Optional: true}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigReadFailed), "the directory is a file: %v", err)
+
+	if os.Geteuid() != 0 {
+		locked := filepath.Join(dir, "locked")
+		require.NoError(t, os.Mkdir(locked, 0o000))
+		_, err = Init(WithLocalFile(LocalOption{Directory: locked, Optional: true}))
+		require.True(t, failure.Is(err, liberrors.ErrConfigReadFailed), "permission denied: %v", err)
+	}
+}
+
+func TestOptionalConsul(t *testing.T) {
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	if err != nil {
+		t.Skip("Skip tests because consul server is not available")
+	}
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	defer func() {
+		_ = server.Stop()
+	}()
+
+	opt := ConsulOption{
+		Endpoint: server.HTTPAddr,
+		Path:     "OPTIONAL_CONFIG",
+		Optional: true,
+	}
+	_, err = Init(WithConsul(ConsulOption{Endpoint: opt.Endpoint, Path: opt.Path}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigKeyNotFound))
+
+	conf, err := Init(WithConsul(opt))
+	require.NoError(t, err)
+	require.Equal(t, []SourceInfo{
+		{Name: "consul://" + server.HTTPAddr + "/OPTIONAL_CONFIG", Optional: true, Skipped: true},
+	}, conf.Sources())
+
+	server.SetKV(t, "OPTIONAL_CONFIG", []byte("x: 1\n"))
+	require.NoError(t, conf.Reload())
+	require.Equal(t, 1, conf.Get("x"))
+	sources := conf.Sources()
+	require.Len(t, sources, 1)
+	require.False(t, sources[0].Skipped)
+	require.NotEmpty(t, sources[0].Metadata["index"])
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/spf13/viper"
+)
+
+// Document is the remote config document with its revision.
+type Document struct {
+	Data  []byte
+	Index uint64 // the consul ModifyIndex of the key. 0 if the key does not exist.
+}
+
+// Validator is implemented by the config schema to check the decoded values.
+type Validator interface {
+	Validate() error
+}
+
+// Validate decodes the document encoded in the config type into a new value
+// of the schema type. The document must not have keys unknown to the schema,
+// and the schema's Validate is called if it implements Validator.
+// The directives and tombstones are resolved by the merge strategies of the options,
+// and the document is upgraded by their migrations before it is decoded.
+// The version of the document is not a key of the schema.
+func Validate(data []byte, format string, schema interface{}, opts ...Option) error {
+	rt := reflect.TypeOf(schema)
+	if rt == nil {
+		return failure.New(liberrors.ErrConfigValidationFailed, failure.Message("Schema required"))
+	}
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	fctx := failure.Context{"schema": fmt.Sprintf("%T", schema)}
+
+	var o option
+	for i := range opts {
+		opts[i](&o)
+	}
+	doc, err := Decode(data, format)
+	if err != nil {
+		return failure.Translate(err, liberrors.ErrConfigValidationFailed)
+	}
+	settings := make(map[string]interface{}, len(doc))
+	if err = mergeMaps(settings, doc, "", o.strategies); err != nil {
+		return failure.Translate(err, liberrors.ErrConfigValidationFailed, fctx)
+	}
+	if err = Migrate(settings, o.migrations...); err != nil {
+		return failure.Translate(err, liberrors.ErrConfigValidationFailed, fctx)
+	}
+	delete(settings, VersionKey)
+
+	val := reflect.New(rt).Interface()
+	v := viper.New()
+	if err = v.MergeConfigMap(settings); err != nil {
+		return failure.Translate(err, liberrors.ErrConfigValidationFailed, fctx)
+	}
+	if err = v.UnmarshalExact(val); err != nil {
+		return failure.Translate(err, liberrors.ErrConfigValidationFailed, fctx)
+	}
+	if validator, ok := val.(Validator); ok {
+		if err = validator.Validate(); err != nil {
+			return failure.Translate(err, liberrors.ErrConfigValidationFailed, fctx)
+		}
+	}
+	return nil
+}
+
+// Fetch reads the consul config document for editing.
+// The returned index is passed to Publish to detect the concurrent changes.
+func Fetch(ctx context.Context, opt ConsulOption) (doc Document, err error) {
+	var o option
+	WithConsul(opt)(&o)
+	client, err := consulClient(o.remoteEndpoint)
+	if err != nil {
+		return
+	}
+	pair, _, err := client.KV().Get(o.remotePath, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		err = failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, failure.Context{
+			"endpoint": o.remoteEndpoint,
+			"path":     o.remotePath,
+		})
+		return
+	}
+	if pair != nil {
+		doc = Document{
+			Data:  pair.Value,
+			Index: pair.ModifyIndex,
+		}
+	}
+	return
+}
+
+// Publish validates the document against the schema and writes it to the consul key
+// if the key is not modified since doc.Index, otherwise ErrConfigConflict is returned.
+// The other errors of the write, e.g. the ACL denials, are ErrConfigPublishFailed.
+// The options are the ones of Init: the document is validated by their merge strategies
+// and migrations, and the signature is written with the document if WithSignature
+// has the private key.
+func Publish(ctx context.Context, opt ConsulOption, doc Document, schema interface{}, opts ...Option) error {
+	var o option
+	WithConsul(opt)(&o)
+	for i := range opts {
+		opts[i](&o)
+	}
+	if err := Validate(doc.Data, o.remoteType, schema, opts...); err != nil {
+		return err
+	}
+
+	fctx := failure.Context{
+		"endpoint": o.remoteEndpoint,
+		"path":     o.remotePath,
+		"index":    fmt.Sprint(doc.Index),
+	}
+	ops := api.TxnOps{
+		{KV: &api.KVTxnOp{Verb: api.KVCAS, Key: o.remotePath, Value: doc.Data, Index: doc.Index}},
+	}
+	if o.verifier != nil {
+		sig, err := o.verifier.sign(o.remoteSource(), doc.Data)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, &api.TxnOp{
+			KV: &api.KVTxnOp{Verb: api.KVSet, Key: o.remotePath + o.verifier.suffix, Value: sig},
+		})
+	}
+
+	client, err := consulClient(o.remoteEndpoint)
+	if err != nil {
+		return err
+	}
+	ok, resp, _, err := client.Txn().Txn(ops, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			return failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, fctx)
+		}
+		return failure.Translate(err, liberrors.ErrConfigPublishFailed, fctx)
+	}
+	if !ok {
+		return txnError(resp, fctx)
+	}
+	return nil
+}
+
+// txnError returns ErrConfigConflict if the CAS of the document fails on the stale index,
+// otherwise ErrConfigPublishFailed with the errors of the operations.
+func txnError(resp *api.TxnResponse, fctx failure.Context) error {
+	var whats []string
+	for _, e := range resp.Errors {
+		if e.OpIndex == 0 && strings.Contains(e.What, "index is stale") {
+			return failure.New(liberrors.ErrConfigConflict,
+				failure.Message("Config is modified by others"),
+				fctx,
+			)
+		}
+		whats = append(whats, e.What)
+	}
+	return failure.New(liberrors.ErrConfigPublishFailed,
+		failure.Messagef("Config is not published: %s", strings.Join(whats, "; ")),
+		fctx,
+	)
+}
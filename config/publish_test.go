@@ -0,0 +1,291 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+type publishSchema struct {
+	A struct {
+		B struct {
+			C string
+			D string
+		}
+	}
+}
+
+func (s *publishSchema) Validate() error {
+	if s.A.B.C == "" {
+		return errors.New("a.b.c is required")
+	}
+	return nil
+}
+
+type listSchema struct {
+	A struct {
+		Users []struct {
+			Name string
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+		schema interface{}
+		opts   []Option
+
+		assertion require.ErrorAssertionFunc
+	}{
+		{
+			name:      "valid",
+			data:      "a:\n  b:\n    c: \"1\"\n",
+			format:    "yaml",
+			schema:    &publishSchema{},
+			assertion: require.NoError,
+		},
+		{
+			name:      "unknown key",
+			data:      "a:\n  b:\n    c: \"1\"\n    e: \"1\"\n",
+			format:    "yaml",
+			schema:    &publishSchema{},
+			assertion: require.Error,
+		},
+		{
+			name:      "validator failed",
+			data:      "a:\n  b:\n    d: \"1\"\n",
+			format:    "yaml",
+			schema:    publishSchema{},
+			assertion: require.Error,
+		},
+		{
+			name:      "version",
+			data:      "version: 2\na:\n  b:\n    c: \"1\"\n",
+			format:    "yaml",
+			schema:    &publishSchema{},
+			assertion: require.NoError,
+		},
+		{
+			name:   "migrated",
+			data:   "a:\n  b:\n    e: \"1\"\n",
+			format: "yaml",
+			schema: &publishSchema{},
+			opts: []Option{WithMigrations(Migration{
+				From: 1,
+				Migrate: func(doc map[string]interface{}) error {
+					val, _ := getPath(doc, "a.b.e")
+					deletePath(doc, "a.b.e")
+					setPath(doc, "a.b.c", val)
+					return nil
+				},
+			})},
+			assertion: require.NoError,
+		},
+		{
+			name:      "merge directive",
+			data:      "a:\n  $merge: {users: append}\n  users: [{name: x}]\n",
+			format:    "yaml",
+			schema:    &listSchema{},
+			assertion: require.NoError,
+		},
+		{
+			name:      "invalid merge directive",
+			data:      "a:\n  $merge: {l: prepend}\n  b:\n    c: \"1\"\n",
+			format:    "yaml",
+			schema:    &publishSchema{},
+			assertion: require.Error,
+		},
+		{
+			name:      "tombstone",
+			data:      "a:\n  b:\n    c: \"1\"\n    d: $delete\n",
+			format:    "yaml",
+			schema:    &publishSchema{},
+			assertion: require.NoError,
+		},
+		{
+			name:      "union tombstone",
+			data:      "a:\n  users: [{name: x}, {name: y, $delete: true}]\n",
+			format:    "yaml",
+			schema:    &listSchema{},
+			opts:      []Option{WithMergeStrategy(MergeOption{Key: "a.users", Strategy: MergeUnion})},
+			assertion: require.NoError,
+		},
+		{
+			name:      "parse failed",
+			data:      "{",
+			format:    "json",
+			schema:    &publishSchema{},
+			assertion: require.Error,
+		},
+		{
+			name:      "no schema",
+			data:      "{}",
+			format:    "json",
+			assertion: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.data), tt.format, tt.schema, tt.opts...)
+			tt.assertion(t, err)
+			if err != nil {
+				require.True(t, failure.Is(err, liberrors.ErrConfigValidationFailed))
+			}
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	if err != nil {
+		t.Skip("Skip tests because consul server is not available")
+	}
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	defer func() {
+		_ = server.Stop()
+	}()
+
+	ctx := context.Background()
+	opt := ConsulOption{
+		Endpoint: server.HTTPAddr,
+		Path:     "TESTCONFIG",
+	}
+
+	doc, err := Fetch(ctx, opt)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), doc.Index)
+
+	doc.Data = []byte("a:\n  b:\n    c: \"1\"\n")
+	require.NoError(t, Publish(ctx, opt, doc, &publishSchema{}))
+	err = Publish(ctx, opt, doc, &publishSchema{})
+	require.True(t, failure.Is(err, liberrors.ErrConfigConflict), "key is created by the first publish")
+
+	doc, err = Fetch(ctx, opt)
+	require.NoError(t, err)
+	require.NotZero(t, doc.Index)
+
+	stale := doc
+	doc.Data = []byte("a:\n  b:\n    c: \"2\"\n")
+	require.NoError(t, Publish(ctx, opt, doc, &publishSchema{}))
+	err = Publish(ctx, opt, stale, &publishSchema{})
+	require.True(t, failure.Is(err, liberrors.ErrConfigConflict))
+
+	doc.Data = []byte("a:\n  b:\n    e: \"2\"\n")
+	err = Publish(ctx, opt, doc, &publishSchema{})
+	require.True(t, failure.Is(err, liberrors.ErrConfigValidationFailed))
+
+	conf, err := Init(WithConsul(opt))
+	require.NoError(t, err)
+	var c publishSchema
+	require.NoError(t, conf.Unmarshal(&c))
+	require.Equal(t, "2", c.A.B.C)
+}
+
+func TestPublish_SigningKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	opt := ConsulOption{Endpoint: "127.0.0.1:1"}
+	doc := Document{Data: []byte("a:\n  b:\n    c: \"1\"\n")}
+	err = Publish(ctx, opt, doc, &publishSchema{}, WithSignature(SignatureOption{PublicKeys: []ed25519.PublicKey{pub}}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigSignatureInvalid), "private key is required")
+	err = Publish(ctx, opt, doc, &publishSchema{}, WithSignature(SignatureOption{
+		PublicKeys: []ed25519.PublicKey{otherPub},
+		PrivateKey: priv,
+	}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigSignatureInvalid), "signature is not trusted")
+
+	err = Publish(ctx, opt, doc, &publishSchema{}, WithSignature(SignatureOption{PublicKeys: []ed25519.PublicKey{pub}, PrivateKey: priv}))
+	require.Error(t, err)
+	require.False(t, failure.Is(err, liberrors.ErrConfigSignatureInvalid), "signed and sent to consul")
+}
+
+func TestPublish_Signature(t *testing.T) {
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	if err != nil {
+		t.Skip("Skip tests because consul server is not available")
+	}
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	defer func() {
+		_ = server.Stop()
+	}()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	opt := ConsulOption{
+		Endpoint: server.HTTPAddr,
+		Path:     "SIGNED_CONFIG",
+	}
+	doc := Document{Data: []byte("a:\n  b:\n    c: \"1\"\n")}
+
+	sig := WithSignature(SignatureOption{PublicKeys: []ed25519.PublicKey{pub}, PrivateKey: priv})
+	require.NoError(t, Publish(ctx, opt, doc, &publishSchema{}, sig))
+	conf, err := Init(WithConsul(opt), sig)
+	require.NoError(t, err)
+	require.Equal(t, "1", conf.Get("a.b.c"))
+
+	doc, err = Fetch(ctx, opt)
+	require.NoError(t, err)
+	doc.Data = []byte("a:\n  b:\n    c: \"2\"\n")
+	require.NoError(t, Publish(ctx, opt, doc, &publishSchema{}, sig))
+	require.NoError(t, conf.Reload())
+	require.Equal(t, "2", conf.Get("a.b.c"))
+}
+
+func TestPublish_TxnErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   failure.StringCode
+	}{
+		{"stale index", http.StatusConflict, `{"Errors":[{"OpIndex":0,"What":"failed to set key \"TESTCONFIG\", index is stale"}]}`, liberrors.ErrConfigConflict},
+		{"permission denied", http.StatusConflict, `{"Errors":[{"OpIndex":0,"What":"Permission denied"}]}`, liberrors.ErrConfigPublishFailed},
+		{"too large", http.StatusRequestEntityTooLarge, `Request body too large`, liberrors.ErrConfigPublishFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			opt := ConsulOption{Endpoint: strings.TrimPrefix(server.URL, "http://"), Path: "TESTCONFIG"}
+			err := Publish(context.Background(), opt, Document{Data: []byte("a:\n  b:\n    c: \"1\"\n")}, &publishSchema{})
+			require.True(t, failure.Is(err, tt.want), err)
+		})
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	opt := ConsulOption{Endpoint: strings.TrimPrefix(server.URL, "http://"), Path: "TESTCONFIG"}
+	err := Publish(context.Background(), opt, Document{Data: []byte("a:\n  b:\n    c: \"1\"\n")}, &publishSchema{})
+	require.True(t, failure.Is(err, liberrors.ErrConfigRemoteUnreachable), err)
+	_, err = Fetch(context.Background(), opt)
+	require.True(t, failure.Is(err, liberrors.ErrConfigRemoteUnreachable), err)
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+)
+
+// validate runs the validators against the snapshot before it is used.
+func (o option) validate(s *snapshot) (err error) {
+	if len(o.validators) == 0 {
+		return
+	}
+	conf := &config{
+		store: &store{
+			o:    o,
+			snap: s,
+		},
+	}
+	for _, fn := range o.validators {
+		if err = fn(conf); err != nil {
+			err = failure.Translate(err, liberrors.ErrConfigValidationFailed)
+			return
+		}
+	}
+	return
+}
+
+// watchSignals reloads the config on the reload signals until ctx is done.
+func (c *config) watchSignals(ctx context.Context) {
+	if len(c.o.reloadSignals) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, c.o.reloadSignals...)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				c.reload(sig.String())
+			}
+		}
+	}()
+}
+
+// debouncer coalesces the reload triggers until no trigger arrives for the quiet period,
+// or the max wait has passed since the first coalesced trigger.
+type debouncer struct {
+	quiet   time.Duration
+	maxWait time.Duration
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	triggers []string
+	first    time.Time // the arrival of the first coalesced trigger.
+	stopped  bool
+}
+
+// trigger records the trigger and calls fn with the coalesced triggers after the quiet period.
+func (d *debouncer) trigger(trigger string, fn func(trigger string)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	now := time.Now()
+	if len(d.triggers) == 0 {
+		d.first = now
+	}
+	if !containsString(d.triggers, trigger) {
+		d.triggers = append(d.triggers, trigger)
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	delay := d.quiet
+	if left := d.first.Add(d.maxWait).Sub(now); left < delay {
+		delay = left
+	}
+	d.timer = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		triggers := d.triggers
+		d.triggers = nil
+		stopped := d.stopped
+		d.mu.Unlock()
+		if stopped || len(triggers) == 0 {
+			return
+		}
+		fn(strings.Join(triggers, ","))
+	})
+}
+
+// stop drops the pending triggers.
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = true
+	d.triggers = nil
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+func containsString(ss []string, s string) bool {
+	for i := range ss {
+		if ss[i] == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithValidator(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(fn, []byte("port: 80\n"), 0o600))
+
+	validator := WithValidator(func(conf Config) error {
+		var c struct {
+			Port int
+		}
+		if err := conf.Unmarshal(&c); err != nil {
+			return err
+		}
+		if c.Port <= 0 {
+			return errors.New("port must be positive")
+		}
+		return nil
+	})
+	conf, err := Init(WithLocalFile(LocalOption{Directory: dir}), validator)
+	require.NoError(t, err)
+
+	var changed int
+	conf.OnChange(func() {
+		changed++
+	})
+
+	require.NoError(t, os.WriteFile(fn, []byte("port: -1\n"), 0o600))
+	err = conf.Reload()
+	require.True(t, failure.Is(err, liberrors.ErrConfigValidationFailed))
+	require.Equal(t, 80, conf.Get("port"))
+	require.Equal(t, 0, changed)
+
+	_, err = Init(WithLocalFile(LocalOption{Directory: dir}), validator)
+	require.True(t, failure.Is(err, liberrors.ErrConfigValidationFailed))
+
+	require.NoError(t, os.WriteFile(fn, []byte("port: 8080\n"), 0o600))
+	require.NoError(t, conf.Reload())
+	require.Equal(t, 8080, conf.Get("port"))
+	require.Equal(t, 1, changed)
+}
+
+func TestWithReloadDebounce(t *testing.T) {
+	src1 := &testSource{settings: map[string]interface{}{"x": 1}}
+	src2 := &testSource{settings: map[string]interface{}{"x": 1}}
+	conf, err := Init(
+		WithSource(src1),
+		WithSource(src2),
+		WithReloadDebounce(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer conf.Close()
+
+	var changed int32
+	conf.OnChange(func() {
+		atomic.AddInt32(&changed, 1)
+	})
+
+	for i := 2; i <= 10; i++ {
+		src1.settings["x"] = i
+		src2.settings["x"] = i
+		src1.notify()
+		src2.notify()
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&changed) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 10, conf.Get("x"))
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&changed), "burst is coalesced into one reload")
+
+	src1.notify()
+	require.NoError(t, conf.Close())
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&changed), "pending reload is dropped by Close")
+}
+
+func TestWithReloadDebounce_MaxWait(t *testing.T) {
+	src := &testSource{settings: map[string]interface{}{"x": 1}}
+	conf, err := Init(
+		WithSource(src),
+		WithReloadDebounce(50*time.Millisecond),
+		WithReloadMaxWait(150*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer conf.Close()
+
+	var changed int32
+	conf.OnChange(func() {
+		atomic.AddInt32(&changed, 1)
+	})
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(500 * time.Millisecond)
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			src.notify()
+		case <-deadline:
+			done = true
+		}
+	}
+	require.GreaterOrEqual(t, atomic.LoadInt32(&changed), int32(2), "continuous triggers reload once per max wait")
+	require.LessOrEqual(t, atomic.LoadInt32(&changed), int32(4))
+}
+
+func TestWithReloadDebounce_Files(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.yaml", i)), []byte(fmt.Sprintf("k%d: 1\n", i)), 0o600))
+	}
+	local := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(local, "config.yaml"), []byte("x: 1\n"), 0o600))
+
+	conf, err := Init(
+		WithBatchFiles(BatchFileOption{Directory: dir, Watch: true}),
+		WithLocalFile(LocalOption{Directory: local, Watch: true}),
+		WithReloadDebounce(100*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer conf.Close()
+
+	var changes int32
+	conf.OnChange(func() {
+		atomic.AddInt32(&changes, 1)
+	})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.yaml", i)), []byte(fmt.Sprintf("k%d: 2\n", i)), 0o600))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(local, "config.yaml"), []byte("x: 2\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(local, "other.yaml"), []byte("x: 3\n"), 0o600))
+
+	require.Eventually(t, func() bool { return conf.Get("x") == 2 && conf.Get("k9") == 2 }, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&changes), "the burst of file changes is one reload")
+}
+
+func TestWithConsul_Watch(t *testing.T) {
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	if err != nil {
+		t.Skip("Skip tests because consul server is not available")
+	}
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	defer func() {
+		_ = server.Stop()
+	}()
+
+	server.SetKV(t, "WATCH_CONFIG", []byte("x: 1\n"))
+	conf, err := Init(WithConsul(ConsulOption{
+		Endpoint: server.HTTPAddr,
+		Path:     "WATCH_CONFIG",
+		Watch:    true,
+	}))
+	require.NoError(t, err)
+	defer conf.Close()
+
+	server.SetKV(t, "WATCH_CONFIG", []byte("x: 2\n"))
+	require.Eventually(t, func() bool { return conf.Get("x") == 2 }, 5*time.Second, 10*time.Millisecond)
+}
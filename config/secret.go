@@ -0,0 +1,34 @@
+package config
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Secret is a sensitive string such as a password. Unmarshal decodes strings into it.
+// It renders as "****" when printed, marshaled or logged, use Reveal to read the value.
+type Secret string
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return masked
+}
+
+func (s Secret) GoString() string {
+	return `config.Secret("` + masked + `")`
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + masked + `"`), nil
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(masked), nil
+}
+
+func (s Secret) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("value", masked)
+}
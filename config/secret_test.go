@@ -0,0 +1,53 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecret(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("host: localhost\npassword: p@ss\npin: 1234\n"), 0o600))
+
+	conf, err := Init(WithLocalFile(LocalOption{Directory: dir}))
+	require.NoError(t, err)
+
+	var c struct {
+		Host     string
+		Password Secret
+		Pin      Secret
+	}
+	require.NoError(t, conf.Unmarshal(&c))
+	require.Equal(t, "p@ss", c.Password.Reveal())
+	require.Equal(t, "1234", c.Pin.Reveal())
+
+	require.Equal(t, "****", c.Password.String())
+	require.Equal(t, "{localhost **** ****}", fmt.Sprintf("%v", c))
+	require.Contains(t, fmt.Sprintf("%#v", c), `Password:config.Secret("****")`)
+
+	b, err := json.Marshal(c)
+	require.NoError(t, err)
+	require.Equal(t, `{"Host":"localhost","Password":"****","Pin":"****"}`, string(b))
+
+	b, err = json.Marshal(map[Secret]string{c.Password: "x"})
+	require.NoError(t, err)
+	require.Equal(t, `{"****":"x"}`, string(b))
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Info().
+		Interface("config", c).
+		Object("password", c.Password).
+		Stringer("pin", c.Pin).
+		Msg("")
+	require.NotContains(t, buf.String(), "p@ss")
+	require.NotContains(t, buf.String(), "1234")
+	require.Contains(t, buf.String(), `"password":{"value":"****"}`)
+}
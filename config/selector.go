@@ -0,0 +1,116 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/morikuni/failure"
+	"github.com/spf13/viper"
+)
+
+// selectorBlocks are the keys of the label blocks from the least to the most specific.
+var selectorBlocks = []string{"regions", "zones", "clusters"}
+
+type SelectorOption struct {
+	Region  string // the region label, e.g. `eu-west`. Default: $REGION
+	Zone    string // the zone label, e.g. `eu-west-1a`. Default: $ZONE
+	Cluster string // the cluster label. Default: $CLUSTER
+}
+
+// WithSelector flattens the blocks of the labels onto the config, e.g.
+//
+//	http: {port: 80}
+//	regions:
+//	  eu-west: {http: {port: 8080}}
+//
+// The matching blocks of `regions`, `zones` and `clusters` are merged in this order,
+// so the most specific one takes precedence. The blocks are removed from the config.
+// The blocks are flattened in every local file, remote config, custom source and
+// tenant overlay before it is merged, so a later source takes precedence over the
+// blocks of an earlier one. A `regions`, `zones` or `clusters`
+// key which is not a map is a regular key.
+func WithSelector(opt SelectorOption) Option {
+	return func(o *option) {
+		labels := []string{opt.Region, opt.Zone, opt.Cluster}
+		o.selector = make(map[string]string, len(selectorBlocks))
+		for i, block := range selectorBlocks {
+			if labels[i] == "" {
+				labels[i] = os.Getenv(strings.ToUpper(strings.TrimSuffix(block, "s")))
+			}
+			o.selector[block] = strings.ToLower(labels[i])
+		}
+	}
+}
+
+// selectSettings returns the settings flattened with the blocks of the selector labels.
+// The settings are returned as is if there is no selector or block.
+func (o option) selectSettings(settings map[string]interface{}, fctx failure.Context) (map[string]interface{}, error) {
+	if o.selector == nil {
+		return settings, nil
+	}
+	var blocks []map[string]interface{}
+	var names []string
+	found := false
+	for _, key := range selectorBlocks {
+		k, ok := foldKey(settings, key)
+		if !ok {
+			continue
+		}
+		block, ok := toMap(settings[k])
+		if !ok {
+			continue
+		}
+		if !found {
+			settings = copyMap(settings)
+			found = true
+		}
+		delete(settings, k)
+		label := o.selector[key]
+		if label == "" {
+			continue
+		}
+		if l, ok := foldKey(block, label); ok {
+			if m, ok := toMap(block[l]); ok {
+				blocks = append(blocks, m)
+				names = append(names, key+"."+label)
+			}
+		}
+	}
+	if !found {
+		return settings, nil
+	}
+
+	selected := viper.New()
+	if err := selected.MergeConfigMap(settings); err != nil {
+		return nil, failure.Wrap(err, fctx)
+	}
+	for i := range blocks {
+		var err error
+		if selected, err = o.merge(selected, blocks[i], failure.Context{"selector": names[i]}); err != nil {
+			return nil, failure.Wrap(err, fctx)
+		}
+	}
+	return selected.AllSettings(), nil
+}
+
+// foldKey returns the key of the map equal to key under case-folding.
+func foldKey(m map[string]interface{}, key string) (string, bool) {
+	if _, ok := m[key]; ok {
+		return key, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// copyMap returns the shallow copy of the map.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
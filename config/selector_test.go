@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSelector(t *testing.T) {
+	doc := `
+http:
+  port: 80
+  host: base
+log: info
+regions:
+  eu-west:
+    http: {port: 8080}
+    log: debug
+  us-east:
+    http: {port: 9090}
+zones:
+  eu-west-1a:
+    http: {host: zone}
+clusters:
+  blue:
+    log: warn
+`
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(doc), 0o600))
+
+	tests := []struct {
+		name string
+		opt  *SelectorOption
+		env  map[string]string
+		want map[string]interface{}
+	}{
+		{
+			name: "no selector",
+			want: map[string]interface{}{"http.port": 80, "regions.us-east.http.port": 9090},
+		},
+		{
+			name: "region",
+			opt:  &SelectorOption{Region: "EU-West"},
+			want: map[string]interface{}{"http.port": 8080, "http.host": "base", "log": "debug", "regions": nil},
+		},
+		{
+			name: "most specific last",
+			opt:  &SelectorOption{Region: "eu-west", Zone: "eu-west-1a", Cluster: "blue"},
+			want: map[string]interface{}{"http.port": 8080, "http.host": "zone", "log": "warn", "zones": nil, "clusters": nil},
+		},
+		{
+			name: "labels from env",
+			opt:  &SelectorOption{},
+			env:  map[string]string{"REGION": "us-east", "CLUSTER": "green"},
+			want: map[string]interface{}{"http.port": 9090, "log": "info"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			opts := []Option{WithLocalFile(LocalOption{Directory: dir})}
+			if tt.opt != nil {
+				opts = append(opts, WithSelector(*tt.opt))
+			}
+			conf, err := Init(opts...)
+			require.NoError(t, err)
+			for key, want := range tt.want {
+				require.Equal(t, want, conf.Get(key), key)
+			}
+		})
+	}
+}
+
+func TestWithSelector_Layers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("regions: [us-east, eu-west]\nport: 80\n"), 0o600))
+	tenants := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tenants, "acme"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tenants, "acme", "config.yaml"),
+		[]byte("zones:\n  eu-west-1a: {port: 8443}\n"), 0o600))
+
+	src := &selectorSource{settings: map[string]interface{}{
+		"port":    8000,
+		"Regions": map[string]interface{}{"EU-West": map[string]interface{}{"port": 8080}},
+	}}
+	conf, err := Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithSource(src),
+		WithTenantFiles(TenantFileOption{Directory: tenants}),
+		WithSelector(SelectorOption{Region: "eu-west", Zone: "eu-west-1a"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 8080, conf.Get("port"), "the block of the custom source is flattened")
+	require.Nil(t, conf.Get("regions.eu-west"))
+
+	ctx := xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.TenantKey, "acme"))
+	require.Equal(t, 8443, conf.Tenant(ctx).Get("port"), "the block of the tenant overlay is flattened")
+	require.Nil(t, conf.Tenant(ctx).Get("zones"))
+
+	conf, err = Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithSelector(SelectorOption{Region: "eu-west"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"us-east", "eu-west"}, conf.Get("regions"), "the list is not a block")
+
+	batch := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(batch, "00-base.yaml"), []byte("port: 80\nregions:\n  eu: {port: 8080}\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(batch, "10-override.yaml"), []byte("port: 9000\n"), 0o600))
+	conf, err = Init(
+		WithBatchFiles(BatchFileOption{Directory: batch}),
+		WithSelector(SelectorOption{Region: "eu"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 9000, conf.Get("port"), "the later file takes precedence over the block of the earlier one")
+}
+
+// selectorSource returns the settings as is.
+type selectorSource struct {
+	settings map[string]interface{}
+}
+
+func (s *selectorSource) Name() string {
+	return "selector"
+}
+
+func (s *selectorSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	return s.settings, nil
+}
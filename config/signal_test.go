@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithReloadSignal(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(fn, []byte("port: 80\n"), 0o600))
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithReloadSignal(syscall.SIGUSR1),
+	)
+	require.NoError(t, err)
+	defer conf.Close()
+
+	changed := make(chan struct{}, 1)
+	conf.OnChange(func() {
+		changed <- struct{}{}
+	})
+
+	require.NoError(t, os.WriteFile(fn, []byte("port: 8080\n"), 0o600))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config is not reloaded")
+	}
+	require.Equal(t, 8080, conf.Get("port"))
+}
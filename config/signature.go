@@ -0,0 +1,89 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"os"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+)
+
+type SignatureOption struct {
+	PublicKeys []ed25519.PublicKey // the trusted keys, a document signed by any of them is accepted.
+	PrivateKey ed25519.PrivateKey  // the key signing the documents written by Publish.
+	Suffix     string              // the suffix of the sidecar file or consul key of the signature. Default: ".sig"
+}
+
+// Sign returns the detached signature of the document in base64, which is
+// stored in the sidecar file `<file>.sig` or the consul key `<key>.sig`.
+func Sign(key ed25519.PrivateKey, data []byte) []byte {
+	sig := ed25519.Sign(key, data)
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(sig)))
+	base64.StdEncoding.Encode(out, sig)
+	return out
+}
+
+type verifier struct {
+	keys    []ed25519.PublicKey
+	private ed25519.PrivateKey
+	suffix  string
+}
+
+// sign returns the signature of the data to publish, which must be verified by the trusted keys.
+func (v *verifier) sign(name string, data []byte) (sig []byte, err error) {
+	if len(v.private) == 0 {
+		err = failure.New(liberrors.ErrConfigSignatureInvalid,
+			failure.Message("Private key required to sign the config"),
+			failure.Context{"config": name},
+		)
+		return
+	}
+	sig = Sign(v.private, data)
+	if len(v.keys) > 0 {
+		err = v.verify(name, data, sig)
+	}
+	return
+}
+
+// verifyFile verifies the file data against the sidecar signature file.
+func (v *verifier) verifyFile(path string, data []byte) (err error) {
+	if v == nil {
+		return
+	}
+	sig, err := os.ReadFile(path + v.suffix)
+	if err != nil {
+		return failure.Translate(err, liberrors.ErrConfigSignatureInvalid,
+			failure.Message("Signature not found"),
+			failure.Context{"config": path, "signature": path + v.suffix},
+		)
+	}
+	return v.verify(path, data, sig)
+}
+
+// verify verifies the data against the signature in base64 or raw bytes.
+func (v *verifier) verify(name string, data, sig []byte) error {
+	if v == nil {
+		return nil
+	}
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return failure.Translate(err, liberrors.ErrConfigSignatureInvalid,
+				failure.Message("Malformed signature"),
+				failure.Context{"config": name},
+			)
+		}
+		sig = decoded
+	}
+	for _, key := range v.keys {
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	}
+	return failure.New(liberrors.ErrConfigSignatureInvalid,
+		failure.Message("Signature verification failed"),
+		failure.Context{"config": name},
+	)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	doc := []byte("x: 1\n")
+	tests := []struct {
+		name    string
+		data    []byte
+		sig     []byte // no sidecar file if nil.
+		keys    []ed25519.PublicKey
+		wantErr bool
+	}{
+		{"base64 signature", doc, Sign(priv, doc), []ed25519.PublicKey{pub}, false},
+		{"raw signature", doc, ed25519.Sign(priv, doc), []ed25519.PublicKey{pub}, false},
+		{"any trusted key", doc, Sign(otherPriv, doc), []ed25519.PublicKey{pub, otherPub}, false},
+		{"untrusted key", doc, Sign(otherPriv, doc), []ed25519.PublicKey{pub}, true},
+		{"tampered document", []byte("x: 2\n"), Sign(priv, doc), []ed25519.PublicKey{pub}, true},
+		{"malformed signature", doc, []byte("not a signature"), []ed25519.PublicKey{pub}, true},
+		{"missing signature", doc, nil, []ed25519.PublicKey{pub}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.yaml")
+			require.NoError(t, os.WriteFile(path, tt.data, 0o600))
+			if tt.sig != nil {
+				require.NoError(t, os.WriteFile(path+".sig", tt.sig, 0o600))
+			}
+
+			for _, opt := range []Option{
+				WithLocalFile(LocalOption{Directory: dir}),
+				WithBatchFiles(BatchFileOption{Directory: dir}),
+			} {
+				conf, err := Init(opt, WithSignature(SignatureOption{PublicKeys: tt.keys}))
+				if tt.wantErr {
+					require.True(t, failure.Is(err, liberrors.ErrConfigSignatureInvalid), err)
+					continue
+				}
+				require.NoError(t, err)
+				require.Equal(t, 1, conf.Get("x"))
+			}
+		})
+	}
+}
+
+func TestWithSignature_Consul(t *testing.T) {
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	if err != nil {
+		t.Skip("Skip tests because consul server is not available")
+	}
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	defer func() {
+		_ = server.Stop()
+	}()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	doc := []byte("x: 1\n")
+	server.SetKV(t, "SIGNED_CONFIG", doc)
+
+	opts := []Option{
+		WithConsul(ConsulOption{Endpoint: server.HTTPAddr, Path: "SIGNED_CONFIG"}),
+		WithSignature(SignatureOption{PublicKeys: []ed25519.PublicKey{pub}}),
+	}
+	_, err = Init(opts...)
+	require.True(t, failure.Is(err, liberrors.ErrConfigSignatureInvalid), "signature key is missing")
+
+	server.SetKV(t, "SIGNED_CONFIG.sig", Sign(priv, doc))
+	conf, err := Init(opts...)
+	require.NoError(t, err)
+	require.Equal(t, 1, conf.Get("x"))
+
+	server.SetKV(t, "SIGNED_CONFIG", []byte("x: 2\n"))
+	require.True(t, failure.Is(conf.Reload(), liberrors.ErrConfigSignatureInvalid))
+	require.Equal(t, 1, conf.Get("x"))
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/spf13/viper"
+)
+
+// Snapshot is an immutable view of the config. Pin one snapshot per request
+// to read consistent settings while the config reloads.
+type Snapshot interface {
+	Unmarshal(interface{}) error
+	UnmarshalKey(key string, v interface{}) error
+	// Get returns a copy of the value of key, or nil if the key does not exist.
+	Get(key string) interface{}
+	// AllSettings returns a copy of the merged settings.
+	AllSettings() map[string]interface{}
+	// Tenant returns the snapshot merged with the overlay of the tenant in ctx.
+	Tenant(ctx context.Context) Snapshot
+	// Sources returns the provenance of the sources merged into the snapshot.
+	Sources() []SourceInfo
+	// Version increases by one on every successful reload.
+	Version() uint64
+	// Hash is the SHA-256 of the merged settings and tenant overlays in hex.
+	// Reloads without changes keep the hash.
+	Hash() string
+}
+
+type pinned struct {
+	snap   *snapshot
+	tenant string
+	access *accessTracker
+}
+
+func (c *config) Snapshot() Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &pinned{
+		snap:   c.snap,
+		tenant: c.tenant,
+		access: c.access,
+	}
+}
+
+func (p *pinned) Unmarshal(v interface{}) error {
+	p.access.read("", v)
+	return unmarshalCopy(p.snap.view(p.tenant), "", v)
+}
+
+func (p *pinned) UnmarshalKey(key string, v interface{}) error {
+	p.access.read(key, v)
+	return unmarshalCopy(p.snap.view(p.tenant), key, v)
+}
+
+func (p *pinned) Get(key string) interface{} {
+	p.access.read(key, nil)
+	return deepCopy(p.snap.view(p.tenant).Get(key))
+}
+
+func (p *pinned) AllSettings() map[string]interface{} {
+	p.access.read("", nil)
+	settings, _ := deepCopy(p.snap.view(p.tenant).AllSettings()).(map[string]interface{})
+	return settings
+}
+
+func (p *pinned) Tenant(ctx context.Context) Snapshot {
+	return &pinned{
+		snap:   p.snap,
+		tenant: xcontext.TenantFromContext(ctx),
+		access: p.access,
+	}
+}
+
+func (p *pinned) Sources() []SourceInfo {
+	sources := make([]SourceInfo, len(p.snap.sources))
+	copy(sources, p.snap.sources)
+	return sources
+}
+
+func (p *pinned) Version() uint64 {
+	return p.snap.version
+}
+
+func (p *pinned) Hash() string {
+	return p.snap.hash
+}
+
+// view returns the merged settings of the tenant, or the base settings if the tenant has no overlay.
+func (s *snapshot) view(tenant string) *viper.Viper {
+	if v, ok := s.tenants[tenant]; ok {
+		return v
+	}
+	return s.v
+}
+
+// contentHash returns the hash of the merged settings and tenant overlays.
+// The settings are hashed in canonical JSON, in which the map keys are sorted
+// and the equal numbers of different types are encoded alike.
+func (s *snapshot) contentHash() string {
+	tenants := make(map[string]interface{}, len(s.tenants))
+	for id, v := range s.tenants {
+		tenants[id] = canonical(v.AllSettings())
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"settings": canonical(s.v.AllSettings()),
+		"tenants":  tenants,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonical returns the value with string keyed maps, and the values JSON cannot encode as strings.
+func canonical(v interface{}) interface{} {
+	if m, ok := toMap(v); ok {
+		out := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			out[k] = canonical(val)
+		}
+		return out
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = canonical(rv.Index(i).Interface())
+		}
+		return out
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return v
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// unmarshalCopy decodes a copy of the settings under key, or all settings if key is empty,
+// so the decoded maps and slices are not shared with the snapshot.
+func unmarshalCopy(v *viper.Viper, key string, out interface{}) error {
+	tmp := viper.New()
+	if key == "" {
+		settings, _ := deepCopy(v.AllSettings()).(map[string]interface{})
+		if err := tmp.MergeConfigMap(settings); err != nil {
+			return err
+		}
+		return tmp.Unmarshal(out)
+	}
+	tmp.Set(key, deepCopy(v.Get(key)))
+	return tmp.UnmarshalKey(key, out)
+}
+
+// deepCopy returns the copy of the value with its nested maps and slices copied.
+func deepCopy(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = deepCopy(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[interface{}]interface{}, len(val))
+		for k, item := range val {
+			out[k] = deepCopy(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i := range val {
+			out[i] = deepCopy(val[i])
+		}
+		return out
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		reflect.Copy(out, rv)
+		return out.Interface()
+	case reflect.Map:
+		if rv.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return out.Interface()
+	}
+	return v
+}
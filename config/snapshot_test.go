@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(fn, []byte("port: 80\nhost: a\n"), 0o600))
+	tenants := t.TempDir()
+	acme := filepath.Join(tenants, "acme", "config.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(acme), 0o755))
+	require.NoError(t, os.WriteFile(acme, []byte("port: 81\n"), 0o600))
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{Directory: dir}),
+		WithTenantFiles(TenantFileOption{Directory: tenants}),
+	)
+	require.NoError(t, err)
+	ctx := xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.TenantKey, "acme"))
+
+	first := conf.Snapshot()
+	require.Equal(t, uint64(1), first.Version())
+	require.Len(t, first.Hash(), 64)
+	require.Equal(t, conf.Sources(), first.Sources())
+
+	require.NoError(t, os.WriteFile(fn, []byte("port: 8080\nhost: b\n"), 0o600))
+	require.NoError(t, os.WriteFile(acme, []byte("port: 8081\n"), 0o600))
+	require.NoError(t, conf.Reload())
+
+	require.Equal(t, 80, first.Get("port"), "snapshot is not changed by reloads")
+	require.Equal(t, 81, first.Tenant(ctx).Get("port"))
+	var c struct {
+		Port int
+		Host string
+	}
+	require.NoError(t, first.Unmarshal(&c))
+	require.Equal(t, "a", c.Host)
+	require.NoError(t, first.Tenant(ctx).UnmarshalKey("port", &c.Port))
+	require.Equal(t, 81, c.Port)
+
+	second := conf.Tenant(ctx).Snapshot()
+	require.Equal(t, uint64(2), second.Version())
+	require.NotEqual(t, first.Hash(), second.Hash())
+	require.Equal(t, 8081, second.Get("port"), "snapshot of the tenant view")
+	require.Equal(t, 8080, second.Tenant(context.Background()).Get("port"))
+
+	require.NoError(t, conf.Reload())
+	third := conf.Snapshot()
+	require.Equal(t, uint64(3), third.Version())
+	require.Equal(t, second.Hash(), third.Hash(), "unchanged content keeps the hash")
+}
+
+func TestSnapshot_Copy(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("db:\n  hosts: [a, b]\n  port: 80\n"), 0o600))
+	conf, err := Init(WithLocalFile(LocalOption{Directory: dir}))
+	require.NoError(t, err)
+
+	snap := conf.Snapshot()
+	db := snap.Get("db").(map[string]interface{})
+	db["port"] = 81
+	db["hosts"].([]interface{})[0] = "c"
+	all := snap.AllSettings()
+	all["db"].(map[string]interface{})["port"] = 82
+
+	require.Equal(t, 80, snap.Get("db.port"))
+	require.Equal(t, []interface{}{"a", "b"}, snap.Get("db.hosts"))
+	require.Equal(t, 80, conf.Get("db.port"))
+}
+
+func TestSnapshot_HashFormats(t *testing.T) {
+	yamlDir, jsonDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(yamlDir, "config.yaml"), []byte("port: 80\ndb:\n  hosts: [a, b]\n  ratio: 0.5\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(jsonDir, "config.json"), []byte(`{"db": {"ratio": 0.5, "hosts": ["a", "b"]}, "port": 80}`), 0o600))
+
+	fromYAML, err := Init(WithLocalFile(LocalOption{Directory: yamlDir}))
+	require.NoError(t, err)
+	fromJSON, err := Init(WithLocalFile(LocalOption{Directory: jsonDir}))
+	require.NoError(t, err)
+	require.Equal(t, fromYAML.Snapshot().Hash(), fromJSON.Snapshot().Hash(), "int and float64 ports hash alike")
+}
+
+func TestSnapshot_ConfigMutation(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("db:\n  hosts: [a, b]\n  port: 80\n"), 0o600))
+	conf, err := Init(WithLocalFile(LocalOption{Directory: dir}))
+	require.NoError(t, err)
+
+	snap := conf.Snapshot()
+	hash := snap.Hash()
+	db := conf.Get("db").(map[string]interface{})
+	db["port"] = 999
+	db["hosts"].([]interface{})[0] = "c"
+	var c struct {
+		DB interface{}
+	}
+	require.NoError(t, conf.Unmarshal(&c))
+	c.DB.(map[string]interface{})["port"] = 998
+	require.NoError(t, conf.UnmarshalKey("db", &c.DB))
+	c.DB.(map[string]interface{})["port"] = 997
+
+	require.Equal(t, 80, snap.Get("db.port"))
+	require.Equal(t, []interface{}{"a", "b"}, snap.Get("db.hosts"))
+	require.Equal(t, 80, conf.Get("db.port"))
+	require.NoError(t, conf.Reload())
+	require.Equal(t, hash, snap.Hash())
+	require.Equal(t, hash, conf.Snapshot().Hash(), "content is not changed by the callers")
+}
+
+func TestSnapshot_ConcurrentReload(t *testing.T) {
+	src := &testSource{settings: map[string]interface{}{"x": 1}}
+	conf, err := Init(WithSource(src))
+	require.NoError(t, err)
+
+	type observed struct {
+		x       []interface{}
+		version []uint64
+	}
+	results := make(chan observed, 4)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			snap := conf.Snapshot()
+			var o observed
+			for j := 0; j < 100; j++ {
+				o.x = append(o.x, snap.Get("x"))
+				o.version = append(o.version, snap.Version())
+			}
+			results <- o
+		}()
+	}
+	for i := 2; i <= 21; i++ {
+		src.settings = map[string]interface{}{"x": i}
+		require.NoError(t, conf.Reload())
+	}
+	wg.Wait()
+	close(results)
+
+	for o := range results {
+		for j := range o.x {
+			require.Equal(t, o.x[0], o.x[j], "value of the pinned snapshot")
+			require.Equal(t, o.version[0], o.version[j], "version of the pinned snapshot")
+		}
+		require.Equal(t, o.version[0], uint64(o.x[0].(int)), "value matches the version")
+	}
+	require.Equal(t, uint64(21), conf.Snapshot().Version())
+}
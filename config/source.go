@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+
+	"github.com/morikuni/failure"
+	"github.com/rs/zerolog/log"
+)
+
+// Source is a custom config source. The sources are merged in order after the
+// local and remote config.
+type Source interface {
+	// Name identifies the source in the errors and logs.
+	Name() string
+	// Load returns the settings of the source. The config takes the ownership of the returned map.
+	Load(ctx context.Context) (map[string]interface{}, error)
+}
+
+// Watcher is implemented by the sources notifying their changes.
+// The config reloads when notify is called.
+type Watcher interface {
+	// Watch starts watching the changes and returns.
+	// notify is called on every change until ctx is done.
+	Watch(ctx context.Context, notify func()) error
+}
+
+// Describer is implemented by the sources reporting the details of the last Load
+// in the provenance, e.g. the commit of a git source.
+type Describer interface {
+	Metadata() map[string]string
+}
+
+// mergeSources merges the settings of the custom sources.
+func (s *snapshot) mergeSources(ctx context.Context, o option) (err error) {
+	for _, src := range o.sources {
+		var settings map[string]interface{}
+		if settings, err = src.Load(ctx); err != nil {
+			err = failure.Wrap(err, failure.Context{"source": src.Name()})
+			return
+		}
+		o.aliases.apply(src.Name(), settings)
+		if settings, err = o.selectSettings(settings, failure.Context{"source": src.Name()}); err != nil {
+			return
+		}
+		if s.v, err = o.merge(s.v, settings, failure.Context{"source": src.Name()}); err != nil {
+			return
+		}
+		info := SourceInfo{Name: src.Name()}
+		if d, ok := src.(Describer); ok {
+			info.Metadata = d.Metadata()
+		}
+		s.record(info)
+	}
+	return
+}
+
+// watch reloads the config on the changes of the watched sources and the
+// reload signals until Close.
+func (c *config) watch() (err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.watchSignals(ctx)
+	if err = c.watchFiles(ctx); err != nil {
+		cancel()
+		return
+	}
+	if err = c.watchConsul(ctx); err != nil {
+		cancel()
+		return
+	}
+	for _, src := range c.o.sources {
+		w, ok := src.(Watcher)
+		if !ok {
+			continue
+		}
+		name := src.Name()
+		if err = w.Watch(ctx, func() { c.reload(name) }); err != nil {
+			cancel()
+			err = failure.Wrap(err, failure.Context{"source": name})
+			return
+		}
+	}
+	return
+}
+
+// reload reloads the config triggered by the source or signal, or after the quiet
+// period if the reloads are debounced.
+func (c *config) reload(trigger string) {
+	if c.debounce != nil {
+		c.debounce.trigger(trigger, c.reloadNow)
+		return
+	}
+	c.reloadNow(trigger)
+}
+
+// reloadNow reloads the config and logs the outcome.
+func (c *config) reloadNow(trigger string) {
+	if err := c.Reload(); err != nil {
+		log.Error().Err(err).Str("trigger", trigger).Msg("Reload config failed, keep the current config")
+		return
+	}
+	log.Info().Str("trigger", trigger).Msg("Config reloaded")
+}
+
+func (c *config) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.debounce != nil {
+		c.debounce.stop()
+	}
+	return nil
+}
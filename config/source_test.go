@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSource struct {
+	settings map[string]interface{}
+	err      error
+
+	ctx    context.Context
+	notify func()
+}
+
+func (s *testSource) Name() string {
+	return "test"
+}
+
+func (s *testSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return map[string]interface{}{"x": s.settings["x"]}, nil
+}
+
+func (s *testSource) Watch(ctx context.Context, notify func()) error {
+	s.ctx = ctx
+	s.notify = notify
+	return nil
+}
+
+func TestWithSource(t *testing.T) {
+	src := &testSource{settings: map[string]interface{}{"x": 1}}
+	conf, err := Init(
+		WithLocalFile(LocalOption{
+			Directory: "./testfixtures/",
+			Filename:  "local",
+		}),
+		WithSource(src),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 1, conf.Get("x"))
+	require.Equal(t, "1", conf.Get("a.b.c"), "source is merged after local config")
+
+	src.settings["x"] = 2
+	src.notify()
+	require.Equal(t, 2, conf.Get("x"))
+
+	src.err = errors.New("unavailable")
+	src.notify()
+	require.Equal(t, 2, conf.Get("x"))
+
+	require.NoError(t, conf.Close())
+	require.Error(t, src.ctx.Err())
+
+	_, err = Init(WithSource(src))
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/morikuni/failure"
+	"github.com/spf13/viper"
+)
+
+// readTenantFiles reads the tenant overlays from `<dir>/<tenant>/<name>.<ext>`.
+func (s *snapshot) readTenantFiles(o option) (err error) {
+	entries, err := os.ReadDir(o.tenantDir)
+	if err != nil {
+		err = fileError(err, o.tenantDir)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path, format, e := findFile(filepath.Join(o.tenantDir, entry.Name()), o.tenantName, o.tenantType)
+		if e != nil {
+			continue
+		}
+
+		settings, e := readFile(path, format, o.verifier)
+		if e != nil {
+			err = e
+			return
+		}
+		o.aliases.apply(path, settings)
+		if settings, err = o.selectSettings(settings, failure.Context{"config": path}); err != nil {
+			return
+		}
+		s.setTenant(entry.Name(), settings)
+	}
+	return
+}
+
+// readTenantRemote reads the tenant overlays from the consul keys `<prefix>/<tenant>/<name>`.
+// It fails with ErrConfigKeyNotFound if no tenant key exists, unless the overlays are optional.
+func (s *snapshot) readTenantRemote(o option) error {
+	ctx := failure.Context{
+		"endpoint": o.tenantEndpoint,
+		"prefix":   o.tenantPrefix,
+	}
+	client, err := consulClient(o.tenantEndpoint)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(o.tenantPrefix, "/") + "/"
+	pairs, _, err := client.KV().List(prefix, nil)
+	if err != nil {
+		return failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, ctx)
+	}
+	found := false
+	for _, pair := range pairs {
+		parts := strings.Split(strings.TrimPrefix(pair.Key, prefix), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] != o.tenantRemoteName {
+			continue
+		}
+
+		name := "consul://" + o.tenantEndpoint + "/" + pair.Key
+		if err = o.verifyRemote(client, name, pair.Key, pair.Value); err != nil {
+			return err
+		}
+		settings, err := decode(pair.Value, o.tenantRemoteType, name)
+		if err != nil {
+			return err
+		}
+		o.aliases.apply(name, settings)
+		if settings, err = o.selectSettings(settings, failure.Context{"config": name}); err != nil {
+			return err
+		}
+		s.setTenant(parts[0], settings)
+		found = true
+	}
+	if !found {
+		s.skip("consul://" + o.tenantEndpoint + "/" + prefix)
+	}
+	return nil
+}
+
+// setTenant records an overlay of the tenant. Later overlays take precedence.
+func (s *snapshot) setTenant(id string, settings map[string]interface{}) {
+	if s.overlays == nil {
+		s.overlays = make(map[string][]map[string]interface{})
+	}
+	s.overlays[id] = append(s.overlays[id], settings)
+}
+
+// mergeTenants builds the merged view of every tenant on top of the base config.
+func (s *snapshot) mergeTenants(o option) (err error) {
+	s.tenants = make(map[string]*viper.Viper, len(s.overlays))
+	for id, overlays := range s.overlays {
+		v := viper.New()
+		if v, err = o.merge(v, s.v.AllSettings(), failure.Context{"tenant": id}); err != nil {
+			return
+		}
+		for i := range overlays {
+			if v, err = o.merge(v, overlays[i], failure.Context{"tenant": id}); err != nil {
+				return
+			}
+		}
+		s.tenants[id] = v
+	}
+	return
+}
+
+// Tenant returns the config view of the tenant carried by ctx.
+// The view falls back to the base config while the tenant has no overlay.
+func (c *config) Tenant(ctx context.Context) Config {
+	return &config{
+		store:  c.store,
+		tenant: xcontext.TenantFromContext(ctx),
+	}
+}
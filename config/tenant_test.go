@@ -0,0 +1,174 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTenant(t *testing.T, dir, tenant, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, tenant), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tenant, "config.yaml"), []byte(content), 0o600))
+}
+
+func TestTenantFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTenant(t, dir, "acme", "a:\n  b:\n    c: \"3\"\n")
+	writeTenant(t, dir, "globex", "a:\n  b:\n    d: \"4\"\n")
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{
+			Directory: "./testfixtures/",
+			Filename:  "local",
+		}),
+		WithTenantFiles(TenantFileOption{
+			Directory: dir,
+		}),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		tenant string
+		wantC  string
+		wantD  string
+	}{
+		{
+			name:   "No tenant",
+			tenant: "",
+			wantC:  "1",
+			wantD:  "2",
+		},
+		{
+			name:   "Unknown tenant",
+			tenant: "initech",
+			wantC:  "1",
+			wantD:  "2",
+		},
+		{
+			name:   "Override c",
+			tenant: "acme",
+			wantC:  "3",
+			wantD:  "2",
+		},
+		{
+			name:   "Override d",
+			tenant: "globex",
+			wantC:  "1",
+			wantD:  "4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.tenant != "" {
+				ctx = xcontext.AppendContextMetadata(ctx, xcontext.Pairs(xcontext.TenantKey, tt.tenant))
+			}
+			got := conf.Tenant(ctx).(*config)
+			require.Equal(t, tt.wantC, got.current().GetString("a.b.c"))
+			require.Equal(t, tt.wantD, got.current().GetString("a.b.d"))
+		})
+	}
+}
+
+func TestTenantFilesNotFound(t *testing.T) {
+	_, err := Init(
+		WithLocalFile(LocalOption{
+			Directory: "./testfixtures/",
+			Filename:  "local",
+		}),
+		WithTenantFiles(TenantFileOption{
+			Directory: "./testfixtures/not_exists/",
+		}),
+	)
+	require.Error(t, err)
+}
+
+func TestConsulTenants(t *testing.T) {
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	if err != nil {
+		t.Skip("Skip tests because consul server is not available")
+	}
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	defer func() {
+		_ = server.Stop()
+	}()
+
+	server.SetKV(t, "tenants/acme/config", []byte("a:\n  b:\n    c: \"3\"\n"))
+	server.SetKV(t, "tenants/acme/other", []byte("a:\n  b:\n    c: \"5\"\n"))
+
+	dir := t.TempDir()
+	writeTenant(t, dir, "acme", "a:\n  b:\n    c: \"4\"\n    d: \"4\"\n")
+
+	conf, err := Init(
+		WithLocalFile(LocalOption{
+			Directory: "./testfixtures/",
+			Filename:  "local",
+		}),
+		WithTenantFiles(TenantFileOption{
+			Directory: dir,
+		}),
+		WithConsulTenants(ConsulTenantOption{
+			Endpoint: server.HTTPAddr,
+		}),
+	)
+	require.NoError(t, err)
+
+	ctx := xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.TenantKey, "acme"))
+	var c struct {
+		A struct {
+			B struct {
+				C string
+				D string
+			}
+		}
+	}
+	require.NoError(t, conf.Tenant(ctx).Unmarshal(&c))
+	require.Equal(t, "3", c.A.B.C)
+	require.Equal(t, "4", c.A.B.D)
+}
+
+func TestConsulTenants_Empty(t *testing.T) {
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	if err != nil {
+		t.Skip("Skip tests because consul server is not available")
+	}
+	if server.Config.Bootstrap {
+		server.WaitForLeader(t)
+	}
+
+	defer func() {
+		_ = server.Stop()
+	}()
+
+	local := WithLocalFile(LocalOption{
+		Directory: "./testfixtures/",
+		Filename:  "local",
+	})
+	_, err = Init(local, WithConsulTenants(ConsulTenantOption{Endpoint: "127.0.0.1:1"}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigRemoteUnreachable), err)
+
+	conf, err := Init(local, WithConsulTenants(ConsulTenantOption{Endpoint: server.HTTPAddr}))
+	require.NoError(t, err, "no tenant is a valid state")
+	require.Contains(t, conf.Sources(), SourceInfo{
+		Name:     "consul://" + server.HTTPAddr + "/tenants/",
+		Optional: true,
+		Skipped:  true,
+	})
+
+	server.SetKV(t, "tenants/acme/config", []byte("a:\n  b:\n    c: \"3\"\n"))
+	require.NoError(t, conf.Reload())
+	ctx := xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.TenantKey, "acme"))
+	require.Equal(t, "3", conf.Tenant(ctx).Get("a.b.c"))
+}
@@ -0,0 +1,5 @@
+hcl {
+  a {
+    b = "1"
+  }
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// UsageReport is the access of the config keys since Init.
+type UsageReport struct {
+	Reads  map[string]uint64 `json:"reads"`  // the read counts by key. Unmarshal reads the keys of the struct fields.
+	Unused []string          `json:"unused"` // the keys set by the sources but never read.
+	Unset  []string          `json:"unset"`  // the keys read but not set by any source, i.e. the zero values are used.
+}
+
+type accessTracker struct {
+	mu    sync.Mutex
+	reads map[string]uint64
+}
+
+// read records the read of the key, or the keys of the struct fields if v is a struct.
+// The empty key is the whole config.
+func (a *accessTracker) read(key string, v interface{}) {
+	if a == nil {
+		return
+	}
+	keys := []string{key}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct && rv.Type() != timeType {
+		keys = keys[:0]
+		describe(rv, key, func(key string, field reflect.StructField, fv reflect.Value) {
+			keys = append(keys, key)
+		})
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, k := range keys {
+		a.reads[strings.ToLower(k)]++
+	}
+}
+
+// report returns the usage of the keys against the settings.
+func (a *accessTracker) report(settings map[string]interface{}) (r UsageReport) {
+	a.mu.Lock()
+	r.Reads = make(map[string]uint64, len(a.reads))
+	for k, n := range a.reads {
+		r.Reads[k] = n
+	}
+	a.mu.Unlock()
+
+	set := flatten(settings)
+	for key := range set {
+		if !covered(key, r.Reads) {
+			r.Unused = append(r.Unused, key)
+		}
+	}
+	for key := range r.Reads {
+		if !hasKey(set, key) {
+			r.Unset = append(r.Unset, key)
+		}
+	}
+	sort.Strings(r.Unused)
+	sort.Strings(r.Unset)
+	return
+}
+
+// covered reports whether the key or any of its parents is read.
+func covered(key string, reads map[string]uint64) bool {
+	if _, ok := reads[""]; ok {
+		return true
+	}
+	for k := key; ; {
+		if _, ok := reads[k]; ok {
+			return true
+		}
+		i := strings.LastIndex(k, ".")
+		if i < 0 {
+			return false
+		}
+		k = k[:i]
+	}
+}
+
+// hasKey reports whether the key or any of its children is set.
+func hasKey(set map[string]interface{}, key string) bool {
+	if key == "" {
+		return len(set) > 0
+	}
+	if _, ok := set[key]; ok {
+		return true
+	}
+	for k := range set {
+		if strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *config) Usage() UsageReport {
+	if c.access == nil {
+		return UsageReport{}
+	}
+	return c.access.report(c.current().AllSettings())
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAccessTracking(t *testing.T) {
+	dir := t.TempDir()
+	doc := "http:\n  port: 80\n  host: localhost\ndb:\n  dsn: postgres://\nlegacy:\n  flag: true\nservers:\n  a: {port: 1}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(doc), 0o600))
+
+	conf, err := Init(WithLocalFile(LocalOption{Directory: dir}), WithAccessTracking())
+	require.NoError(t, err)
+	require.Empty(t, conf.Usage().Reads)
+
+	var http struct {
+		Port    int
+		Host    string
+		Timeout int
+	}
+	require.NoError(t, conf.UnmarshalKey("http", &http))
+	var servers map[string]interface{}
+	require.NoError(t, conf.UnmarshalKey("servers", &servers))
+	ctx := xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.TenantKey, "acme"))
+	_ = conf.Tenant(ctx).Get("db.dsn")
+	_ = conf.Get("db.dsn")
+	_ = conf.Get("cache.ttl")
+
+	require.Equal(t, UsageReport{
+		Reads: map[string]uint64{
+			"http.port":    1,
+			"http.host":    1,
+			"http.timeout": 1,
+			"servers":      1,
+			"db.dsn":       2,
+			"cache.ttl":    1,
+		},
+		Unused: []string{"legacy.flag"},
+		Unset:  []string{"cache.ttl", "http.timeout"},
+	}, conf.Usage())
+
+	var all map[string]interface{}
+	require.NoError(t, conf.Unmarshal(&all))
+	require.Empty(t, conf.Usage().Unused)
+
+	conf, err = Init(WithLocalFile(LocalOption{Directory: dir}))
+	require.NoError(t, err)
+	_ = conf.Get("http.port")
+	require.Equal(t, UsageReport{}, conf.Usage(), "access is not tracked by default")
+}
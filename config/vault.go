@@ -0,0 +1,392 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/rs/zerolog/log"
+)
+
+// renewRatio is the elapsed part of a lease after which it is renewed.
+const renewRatio = 2.0 / 3
+
+// The backoff of the failed renewals and re-reads, doubled on every failure.
+const (
+	vaultRetryMin = time.Second
+	vaultRetryMax = time.Minute
+)
+
+type VaultOption struct {
+	Address string   // the vault address. Default: "http://127.0.0.1:8200"
+	Mount   string   // the mount path of the KV v2 engine. Default: "secret"
+	Paths   []string // the secret paths under the mount, merged in order.
+	Prefix  string   // the config key prefix of the secrets, e.g. `secrets`. Default: top level keys
+
+	Token        string // the token auth. AppRole auth is used if it is empty.
+	RoleID       string // the AppRole role ID.
+	SecretID     string // the AppRole secret ID.
+	AppRoleMount string // the mount path of the AppRole auth. Default: "approle"
+
+	RefreshInterval time.Duration // re-read interval of the secrets without lease, the config reloads if they changed. Default: no re-read
+	Timeout         time.Duration // the timeout of a request, ignored if Client is set. Default: 30s
+	Client          *http.Client  // the HTTP client. Default: a client of Timeout
+}
+
+// WithVault merges the secrets of the vault KV v2 engine.
+// The token is renewed and the secrets are re-read before their leases expire,
+// and the config reloads when the re-read secrets are changed.
+func WithVault(opt VaultOption) Option {
+	if opt.Address == "" {
+		opt.Address = "http://127.0.0.1:8200"
+	}
+	if opt.Mount == "" {
+		opt.Mount = "secret"
+	}
+	if opt.AppRoleMount == "" {
+		opt.AppRoleMount = "approle"
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = 30 * time.Second
+	}
+	if opt.Client == nil {
+		opt.Client = &http.Client{Timeout: opt.Timeout}
+	}
+	opt.Address = strings.TrimSuffix(opt.Address, "/")
+	return WithSource(&vaultSource{
+		opt:   opt,
+		token: opt.Token,
+	})
+}
+
+type vaultSource struct {
+	opt VaultOption
+
+	mu          sync.Mutex
+	token       string
+	checked     bool // the lease of the token is known.
+	renewable   bool
+	tokenRenew  time.Time              // zero if the token never expires.
+	secretRenew time.Time              // zero if the secrets have no lease.
+	secrets     map[string]interface{} // the secrets of the last read.
+
+	tokenFailures  int
+	secretFailures int
+}
+
+func (s *vaultSource) Name() string {
+	return "vault://" + strings.TrimPrefix(strings.TrimPrefix(s.opt.Address, "http://"), "https://") + "/" + s.opt.Mount
+}
+
+// vaultResponse is the common response of the vault API.
+type vaultResponse struct {
+	Data          json.RawMessage `json:"data"`
+	LeaseDuration int             `json:"lease_duration"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (s *vaultSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	if err := s.login(ctx); err != nil {
+		return nil, err
+	}
+	secrets, lease, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.secrets = secrets
+	s.schedule(lease)
+	s.mu.Unlock()
+
+	settings := make(map[string]interface{}, len(secrets))
+	for k, v := range secrets {
+		settings[k] = v
+	}
+	if s.opt.Prefix != "" {
+		prefixed := make(map[string]interface{})
+		setPath(prefixed, s.opt.Prefix, settings)
+		settings = prefixed
+	}
+	return settings, nil
+}
+
+// read reads the secrets of the paths, and returns the shortest lease of them.
+func (s *vaultSource) read(ctx context.Context) (map[string]interface{}, int, error) {
+	secrets := make(map[string]interface{})
+	lease := 0
+	for _, path := range s.opt.Paths {
+		var resp vaultResponse
+		if err := s.do(ctx, http.MethodGet, "/v1/"+s.opt.Mount+"/data/"+strings.TrimPrefix(path, "/"), nil, &resp); err != nil {
+			return nil, 0, failure.Wrap(err, failure.Context{"path": path})
+		}
+		var data struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(resp.Data, &data); err != nil {
+			return nil, 0, failure.Wrap(err, failure.Context{"path": path})
+		}
+		for k, v := range data.Data {
+			secrets[k] = v
+		}
+		if resp.LeaseDuration > 0 && (lease == 0 || resp.LeaseDuration < lease) {
+			lease = resp.LeaseDuration
+		}
+	}
+	return secrets, lease, nil
+}
+
+// schedule sets the next re-read of the secrets by the lease. The caller holds the lock.
+func (s *vaultSource) schedule(lease int) {
+	s.secretFailures = 0
+	switch {
+	case lease > 0:
+		s.secretRenew = renewAt(lease)
+	case s.opt.RefreshInterval > 0:
+		s.secretRenew = time.Now().Add(s.opt.RefreshInterval)
+	default:
+		s.secretRenew = time.Time{}
+	}
+}
+
+// Watch renews the token and re-reads the secrets before their leases expire,
+// and notifies if the secrets are changed. The failures are retried with backoff.
+func (s *vaultSource) Watch(ctx context.Context, notify func()) error {
+	go func() {
+		for {
+			timer := time.NewTimer(s.next())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			now := time.Now()
+			s.mu.Lock()
+			tokenDue := !s.tokenRenew.IsZero() && !now.Before(s.tokenRenew)
+			secretDue := !s.secretRenew.IsZero() && !now.Before(s.secretRenew)
+			s.mu.Unlock()
+
+			if tokenDue {
+				if err := s.renew(ctx); err != nil {
+					log.Warn().Err(err).Str("source", s.Name()).Msg("Renew vault token failed")
+					s.mu.Lock()
+					s.tokenRenew = time.Now().Add(backoff(s.tokenFailures))
+					s.tokenFailures++
+					s.mu.Unlock()
+				}
+			}
+			if secretDue {
+				changed, err := s.poll(ctx)
+				if err != nil {
+					log.Warn().Err(err).Str("source", s.Name()).Msg("Poll config failed")
+					s.mu.Lock()
+					s.secretRenew = time.Now().Add(backoff(s.secretFailures))
+					s.secretFailures++
+					s.mu.Unlock()
+					continue
+				}
+				if changed {
+					notify()
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// poll re-reads the secrets and reports whether they are changed since the last read,
+// so a change is notified once even if the reload is delayed.
+func (s *vaultSource) poll(ctx context.Context) (bool, error) {
+	secrets, lease, err := s.read(ctx)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule(lease)
+	changed := !reflect.DeepEqual(secrets, s.secrets)
+	s.secrets = secrets
+	return changed, nil
+}
+
+// next returns the duration until the next renewal, checked at least every minute.
+func (s *vaultSource) next() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := time.Now().Add(time.Minute)
+	for _, t := range []time.Time{s.tokenRenew, s.secretRenew} {
+		if !t.IsZero() && t.Before(next) {
+			next = t
+		}
+	}
+	return time.Until(next)
+}
+
+// backoff returns the delay of the retry after the failures.
+func backoff(failures int) time.Duration {
+	d := vaultRetryMin
+	for i := 0; i < failures && d < vaultRetryMax; i++ {
+		d *= 2
+	}
+	if d > vaultRetryMax {
+		d = vaultRetryMax
+	}
+	return d
+}
+
+// login logs in by AppRole if no token is available,
+// or looks up the lease of the given token to renew it.
+func (s *vaultSource) login(ctx context.Context) error {
+	s.mu.Lock()
+	token, checked := s.token, s.checked
+	s.mu.Unlock()
+	if token != "" {
+		if checked {
+			return nil
+		}
+		return s.lookup(ctx)
+	}
+	if s.opt.RoleID == "" {
+		return failure.New(liberrors.ErrConfigReadFailed, failure.Message("Vault token or AppRole is required"))
+	}
+
+	var resp vaultResponse
+	body := map[string]string{
+		"role_id":   s.opt.RoleID,
+		"secret_id": s.opt.SecretID,
+	}
+	if err := s.do(ctx, http.MethodPost, "/v1/auth/"+s.opt.AppRoleMount+"/login", body, &resp); err != nil {
+		return err
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return failure.New(liberrors.ErrConfigReadFailed, failure.Message("Vault login returns no token"))
+	}
+	s.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// lookup reads the TTL of the token.
+func (s *vaultSource) lookup(ctx context.Context) error {
+	var resp vaultResponse
+	if err := s.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil, &resp); err != nil {
+		return err
+	}
+	var data struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return failure.Wrap(err, failure.Context{"source": s.Name()})
+	}
+	s.setToken("", data.TTL, data.Renewable)
+	return nil
+}
+
+// renew renews the token, or logs in again if the token cannot be renewed.
+func (s *vaultSource) renew(ctx context.Context) error {
+	s.mu.Lock()
+	renewable := s.renewable
+	s.mu.Unlock()
+
+	if renewable {
+		var resp vaultResponse
+		err := s.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", nil, &resp)
+		if err == nil && resp.Auth != nil {
+			s.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+			return nil
+		}
+		if s.opt.RoleID == "" {
+			if err == nil {
+				err = failure.New(liberrors.ErrConfigReadFailed, failure.Message("Vault renewal returns no auth"))
+			}
+			return err
+		}
+	}
+	if s.opt.RoleID == "" {
+		s.mu.Lock()
+		s.tokenRenew = time.Time{}
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.mu.Lock()
+	s.token = ""
+	s.mu.Unlock()
+	return s.login(ctx)
+}
+
+func (s *vaultSource) setToken(token string, lease int, renewable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token != "" {
+		s.token = token
+	}
+	s.checked = true
+	s.renewable = renewable
+	s.tokenFailures = 0
+	s.tokenRenew = time.Time{}
+	if lease > 0 {
+		s.tokenRenew = renewAt(lease)
+	}
+}
+
+// do sends the request to the vault API and decodes the response.
+func (s *vaultSource) do(ctx context.Context, method, path string, in, out interface{}) error {
+	fctx := failure.Context{"source": s.Name(), "api": path}
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return failure.Wrap(err, fctx)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.opt.Address+path, &body)
+	if err != nil {
+		return failure.Wrap(err, fctx)
+	}
+	s.mu.Lock()
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	s.mu.Unlock()
+
+	resp, err := s.opt.Client.Do(req)
+	if err != nil {
+		return failure.Translate(err, liberrors.ErrConfigRemoteUnreachable, fctx)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return failure.New(liberrors.ErrConfigKeyNotFound, fctx)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e vaultResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return failure.New(liberrors.ErrConfigReadFailed,
+			failure.Messagef("Vault responds %d: %s", resp.StatusCode, strings.Join(e.Errors, "; ")),
+			fctx,
+		)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return failure.Wrap(err, fctx)
+	}
+	return nil
+}
+
+// renewAt returns the renewal time of the lease in seconds.
+func renewAt(lease int) time.Time {
+	return time.Now().Add(time.Duration(float64(lease) * renewRatio * float64(time.Second)))
+}
@@ -0,0 +1,321 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault is a stand-in of the vault KV v2 engine and AppRole auth.
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+	lease   int
+	logins  int
+	renews  int
+	reads   int
+	down    bool // the secret reads fail.
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			return
+		}
+		f.logins++
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"approle-token","lease_duration":1,"renewable":true}}`))
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if token != "root" && token != "approle-token" && token != "static-token" {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		if token == "root" {
+			_, _ = w.Write([]byte(`{"data":{"ttl":0,"renewable":false}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"ttl":1,"renewable":true}}`))
+		return
+	case "/v1/auth/token/renew-self":
+		f.renews++
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"` + token + `","lease_duration":3600,"renewable":true}}`))
+		return
+	}
+
+	f.reads++
+	if f.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"errors":["sealed"]}`))
+		return
+	}
+	secret, ok := f.secrets[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"lease_duration": f.lease,
+		"data": map[string]interface{}{
+			"data":     secret,
+			"metadata": map[string]interface{}{"version": 1},
+		},
+	})
+}
+
+func (f *fakeVault) set(path, key string, val interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.secrets[path][key] = val
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{
+		secrets: map[string]map[string]interface{}{
+			"/v1/secret/data/app/db":    {"password": "p1", "user": "u"},
+			"/v1/kv/data/app/overrides": {"password": "p2"},
+		},
+	}
+}
+
+func TestWithVault(t *testing.T) {
+	server := httptest.NewServer(newFakeVault())
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		opt  VaultOption
+		want map[string]interface{}
+
+		assertion require.ErrorAssertionFunc
+	}{
+		{
+			name: "token",
+			opt: VaultOption{
+				Address: server.URL,
+				Token:   "root",
+				Paths:   []string{"app/db"},
+				Prefix:  "database",
+			},
+			want: map[string]interface{}{
+				"database.password": "p1",
+				"database.user":     "u",
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "approle",
+			opt: VaultOption{
+				Address:  server.URL,
+				Mount:    "kv",
+				RoleID:   "role",
+				SecretID: "secret",
+				Paths:    []string{"app/overrides"},
+			},
+			want: map[string]interface{}{
+				"password": "p2",
+			},
+			assertion: require.NoError,
+		},
+		{
+			name: "invalid approle",
+			opt: VaultOption{
+				Address:  server.URL,
+				RoleID:   "role",
+				SecretID: "invalid",
+				Paths:    []string{"app/db"},
+			},
+			assertion: require.Error,
+		},
+		{
+			name: "no auth",
+			opt: VaultOption{
+				Address: server.URL,
+				Paths:   []string{"app/db"},
+			},
+			assertion: require.Error,
+		},
+		{
+			name: "permission denied",
+			opt: VaultOption{
+				Address: server.URL,
+				Token:   "invalid",
+				Paths:   []string{"app/db"},
+			},
+			assertion: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := Init(WithVault(tt.opt))
+			tt.assertion(t, err)
+			for k, v := range tt.want {
+				require.Equal(t, v, conf.Get(k))
+			}
+			if conf != nil {
+				require.NoError(t, conf.Close())
+			}
+		})
+	}
+}
+
+func TestWithVault_NotFound(t *testing.T) {
+	server := httptest.NewServer(newFakeVault())
+	defer server.Close()
+
+	src := WithVault(VaultOption{
+		Address: server.URL,
+		Token:   "root",
+		Paths:   []string{"app/missing"},
+	})
+	var o option
+	src(&o)
+	_, err := o.sources[0].Load(context.Background())
+	require.True(t, failure.Is(err, liberrors.ErrConfigKeyNotFound))
+}
+
+func TestWithVault_Renew(t *testing.T) {
+	vault := newFakeVault()
+	vault.lease = 1
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	conf, err := Init(WithVault(VaultOption{
+		Address:  server.URL,
+		RoleID:   "role",
+		SecretID: "secret",
+		Paths:    []string{"app/db"},
+	}))
+	require.NoError(t, err)
+	defer conf.Close()
+	require.Equal(t, "p1", conf.Get("password"))
+
+	changed := make(chan struct{}, 1)
+	conf.OnChange(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	vault.set("/v1/secret/data/app/db", "password", "rotated")
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("secrets are not re-read before the lease expires")
+	}
+	require.Equal(t, "rotated", conf.Get("password"))
+
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	require.Equal(t, 1, vault.logins)
+	require.Equal(t, 1, vault.renews)
+}
+
+func TestWithVault_Refresh(t *testing.T) {
+	vault := newFakeVault()
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	conf, err := Init(
+		WithVault(VaultOption{
+			Address:         server.URL,
+			Token:           "root",
+			Paths:           []string{"app/db"},
+			RefreshInterval: 20 * time.Millisecond,
+		}),
+		WithReloadDebounce(100*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer conf.Close()
+
+	var mu sync.Mutex
+	changes := 0
+	conf.OnChange(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		changes++
+	})
+	reads := func() int {
+		vault.mu.Lock()
+		defer vault.mu.Unlock()
+		return vault.reads
+	}
+	require.Eventually(t, func() bool { return reads() >= 5 }, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	require.Zero(t, changes, "unchanged secrets do not reload")
+	mu.Unlock()
+
+	vault.set("/v1/secret/data/app/db", "password", "rotated")
+	require.Eventually(t, func() bool { return conf.Get("password") == "rotated" }, time.Second, 5*time.Millisecond,
+		"the polls of unchanged secrets do not postpone the debounced reload")
+
+	vault.mu.Lock()
+	vault.down = true
+	vault.mu.Unlock()
+	failed := reads()
+	time.Sleep(300 * time.Millisecond)
+	require.LessOrEqual(t, reads()-failed, 2, "the failed re-reads back off")
+	require.Equal(t, "rotated", conf.Get("password"))
+}
+
+func TestWithVault_RenewStaticToken(t *testing.T) {
+	vault := newFakeVault()
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	conf, err := Init(WithVault(VaultOption{
+		Address: server.URL,
+		Token:   "static-token",
+		Paths:   []string{"app/db"},
+	}))
+	require.NoError(t, err)
+	defer conf.Close()
+	require.Equal(t, "p1", conf.Get("password"))
+
+	require.Eventually(t, func() bool {
+		vault.mu.Lock()
+		defer vault.mu.Unlock()
+		return vault.renews == 1
+	}, 2*time.Second, 10*time.Millisecond, "the token is renewed before its TTL expires")
+}
+
+func TestWithVault_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	start := time.Now()
+	_, err := Init(WithVault(VaultOption{
+		Address: server.URL,
+		Token:   "root",
+		Paths:   []string{"app/db"},
+		Timeout: 50 * time.Millisecond,
+	}))
+	require.True(t, failure.Is(err, liberrors.ErrConfigRemoteUnreachable), err)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
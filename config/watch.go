@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hashicorp/consul/api"
+	"github.com/morikuni/failure"
+	"github.com/rs/zerolog/log"
+)
+
+// The backoff of the failed consul watches, doubled on every failure.
+const (
+	watchRetryMin = time.Second
+	watchRetryMax = time.Minute
+)
+
+// watchFiles reloads the config on the changes of the watched local files and batch
+// directories until ctx is done. The directories which do not exist are not watched.
+func (c *config) watchFiles(ctx context.Context) error {
+	var files []localFile
+	for _, f := range c.o.locals {
+		if f.watch {
+			f.dir = filepath.Clean(f.dir)
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return failure.Wrap(err)
+	}
+	for _, f := range files {
+		if err = addDir(w, f.dir, f.name == ""); err != nil {
+			_ = w.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				for _, f := range files {
+					if !c.watched(f, ev.Name) {
+						continue
+					}
+					if f.name == "" && ev.Op&fsnotify.Create != 0 {
+						if err := addDir(w, ev.Name, true); err != nil {
+							log.Warn().Err(err).Str("config", ev.Name).Msg("Watch config directory failed")
+						}
+					}
+					c.reload(filepath.Join(f.dir, f.name))
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("Watch config files failed")
+			}
+		}
+	}()
+	return nil
+}
+
+// addDir watches the directory, and its sub-directories if recursive.
+func addDir(w *fsnotify.Watcher, dir string, recursive bool) error {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	if !recursive {
+		if err = w.Add(dir); err != nil {
+			return fileError(err, dir)
+		}
+		return nil
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if err = w.Add(path); err != nil {
+			return fileError(err, path)
+		}
+		return nil
+	})
+}
+
+// watched reports whether the changed path is the local file, its signature, or a
+// file or directory in the batch directory.
+func (c *config) watched(f localFile, path string) bool {
+	if c.o.verifier != nil {
+		path = strings.TrimSuffix(path, c.o.verifier.suffix)
+	}
+	if f.name == "" {
+		if !strings.HasPrefix(path, f.dir+string(filepath.Separator)) {
+			return false
+		}
+		format, ok := formatOf(path)
+		if !ok {
+			// the created sub-directory.
+			info, err := os.Stat(path)
+			return err == nil && info.IsDir()
+		}
+		return f.ftype == "" || format == formats[f.ftype]
+	}
+	if filepath.Dir(path) != f.dir {
+		return false
+	}
+	format, ok := formatOf(path)
+	if !ok || (f.ftype != "" && format != formats[f.ftype]) {
+		return false
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) == f.name
+}
+
+// watchConsul reloads the config on the changes of the consul key until ctx is done.
+// The key is watched by the blocking queries from the index of the loaded key.
+func (c *config) watchConsul(ctx context.Context) error {
+	if !c.o.remoteEnable || !c.o.remoteWatch {
+		return nil
+	}
+	client, err := consulClient(c.o.remoteEndpoint)
+	if err != nil {
+		return err
+	}
+	name := c.o.remoteSource()
+	var index uint64
+	for _, info := range c.Sources() {
+		if info.Name == name {
+			index, _ = strconv.ParseUint(info.Metadata["index"], 10, 64)
+		}
+	}
+
+	go func() {
+		retry := watchRetryMin
+		for {
+			_, meta, err := client.KV().Get(c.o.remotePath, (&api.QueryOptions{WaitIndex: index}).WithContext(ctx))
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Warn().Err(err).Str("config", name).Dur("retry", retry).Msg("Watch consul key failed")
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retry):
+				}
+				if retry *= 2; retry > watchRetryMax {
+					retry = watchRetryMax
+				}
+				continue
+			}
+			retry = watchRetryMin
+			switch {
+			case meta.LastIndex < index:
+				// the index is reset, e.g. by a snapshot restore.
+				index = 0
+			case meta.LastIndex > index:
+				if index != 0 {
+					c.reload(name)
+				}
+				index = meta.LastIndex
+			}
+		}
+	}()
+	return nil
+}
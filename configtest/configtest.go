@@ -0,0 +1,49 @@
+// Package configtest provides in-memory configs and a fake remote source for tests.
+package configtest
+
+import (
+	"context"
+
+	"github.com/ipfans/saaslib/config"
+)
+
+// FromMap returns a Config of the settings. The options are applied after the settings source.
+func FromMap(settings map[string]interface{}, opt ...config.Option) (config.Config, error) {
+	return config.Init(append([]config.Option{config.WithSource(Map(settings))}, opt...)...)
+}
+
+// FromYAML returns a Config of the YAML document. The options are applied after the document source.
+func FromYAML(doc string, opt ...config.Option) (config.Config, error) {
+	settings, err := config.Decode([]byte(doc), "yaml")
+	if err != nil {
+		return nil, err
+	}
+	return FromMap(settings, opt...)
+}
+
+// Map returns a config.Source of the static settings.
+func Map(settings map[string]interface{}) config.Source {
+	return mapSource(copyMap(settings))
+}
+
+type mapSource map[string]interface{}
+
+func (m mapSource) Name() string {
+	return "map"
+}
+
+func (m mapSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	return copyMap(m), nil
+}
+
+// copyMap returns a deep copy of the nested maps.
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if nested, ok := v.(map[string]interface{}); ok {
+			v = copyMap(nested)
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package configtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfans/saaslib/config"
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromMap(t *testing.T) {
+	settings := map[string]interface{}{
+		"HTTP": map[string]interface{}{
+			"Port": 8080,
+		},
+	}
+	conf, err := FromMap(settings)
+	require.NoError(t, err)
+	require.Equal(t, 8080, conf.Get("http.port"))
+	require.NoError(t, conf.Reload())
+	require.Equal(t, 8080, conf.Get("http.port"))
+	require.Contains(t, settings, "HTTP", "settings are not modified")
+}
+
+func TestFromYAML(t *testing.T) {
+	tenants := t.TempDir()
+	conf, err := FromYAML("a:\n  b: 1\n", config.WithTenantFiles(config.TenantFileOption{Directory: tenants}))
+	require.NoError(t, err)
+
+	var c struct {
+		A struct {
+			B int
+		}
+	}
+	ctx := xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.TenantKey, "acme"))
+	require.NoError(t, conf.Tenant(ctx).Unmarshal(&c))
+	require.Equal(t, 1, c.A.B)
+
+	_, err = FromYAML("a: [")
+	require.Error(t, err)
+}
+
+func TestRemote(t *testing.T) {
+	remote := NewRemote()
+	_, err := config.Init(config.WithSource(remote.Source("svc/config", "yaml")))
+	require.Error(t, err, "key not found")
+
+	remote.Set("svc/config", []byte("a: 1\n"))
+	conf, err := config.Init(config.WithSource(remote.Source("svc/config", "yaml")))
+	require.NoError(t, err)
+	require.Equal(t, 1, conf.Get("a"))
+
+	var changed int
+	conf.OnChange(func() {
+		changed++
+	})
+
+	remote.Set("svc/config", []byte("a: 2\n"))
+	require.Equal(t, 1, changed)
+	require.Equal(t, 2, conf.Get("a"))
+
+	remote.Set("svc/other", []byte("a: 3\n"))
+	require.Equal(t, 1, changed, "other keys are not watched")
+
+	remote.Set("svc/config", []byte("a: ["))
+	require.Equal(t, 1, changed, "invalid document is not loaded")
+	require.Equal(t, 2, conf.Get("a"))
+
+	remote.Delete("svc/config")
+	require.Equal(t, 1, changed, "missing key is not loaded")
+	require.Equal(t, 2, conf.Get("a"))
+
+	remote.Set("svc/config", []byte("a: 4\n"))
+	require.Equal(t, 2, changed)
+	require.Equal(t, 4, conf.Get("a"))
+
+	doc, ok := remote.Get("svc/config")
+	require.True(t, ok)
+	require.Equal(t, "a: 4\n", string(doc))
+}
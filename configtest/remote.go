@@ -0,0 +1,110 @@
+package configtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ipfans/saaslib/config"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/morikuni/failure"
+)
+
+// Remote is an in-process fake of a remote KV store such as consul.
+// The watchers are notified synchronously by Set and Delete, so the watching
+// configs have reloaded when they return.
+type Remote struct {
+	mu       sync.Mutex
+	docs     map[string][]byte
+	watchers map[string]map[int]func()
+	nextID   int
+}
+
+// NewRemote returns an empty fake remote KV store.
+func NewRemote() *Remote {
+	return &Remote{
+		docs:     make(map[string][]byte),
+		watchers: make(map[string]map[int]func()),
+	}
+}
+
+// Set stores the document at key and notifies the watchers of key.
+func (r *Remote) Set(key string, doc []byte) {
+	r.mu.Lock()
+	r.docs[key] = append([]byte(nil), doc...)
+	r.mu.Unlock()
+	r.notify(key)
+}
+
+// Delete removes the document at key and notifies the watchers of key.
+func (r *Remote) Delete(key string) {
+	r.mu.Lock()
+	delete(r.docs, key)
+	r.mu.Unlock()
+	r.notify(key)
+}
+
+// Get returns the document at key.
+func (r *Remote) Get(key string) (doc []byte, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok = r.docs[key]
+	return
+}
+
+func (r *Remote) notify(key string) {
+	r.mu.Lock()
+	fns := make([]func(), 0, len(r.watchers[key]))
+	for _, fn := range r.watchers[key] {
+		fns = append(fns, fn)
+	}
+	r.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// Source returns a config.Source reading the document at key in the config type.
+func (r *Remote) Source(key, format string) config.Source {
+	return &remoteSource{
+		r:      r,
+		key:    key,
+		format: format,
+	}
+}
+
+type remoteSource struct {
+	r      *Remote
+	key    string
+	format string
+}
+
+func (s *remoteSource) Name() string {
+	return "fake://" + s.key
+}
+
+func (s *remoteSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	doc, ok := s.r.Get(s.key)
+	if !ok {
+		return nil, failure.New(liberrors.ErrConfigKeyNotFound, failure.Context{"key": s.key})
+	}
+	return config.Decode(doc, s.format)
+}
+
+func (s *remoteSource) Watch(ctx context.Context, notify func()) error {
+	s.r.mu.Lock()
+	id := s.r.nextID
+	s.r.nextID++
+	if s.r.watchers[s.key] == nil {
+		s.r.watchers[s.key] = make(map[int]func())
+	}
+	s.r.watchers[s.key][id] = notify
+	s.r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.r.mu.Lock()
+		delete(s.r.watchers[s.key], id)
+		s.r.mu.Unlock()
+	}()
+	return nil
+}
@@ -0,0 +1,186 @@
+package featureflag
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/ipfans/saaslib/config"
+	"github.com/ipfans/saaslib/liberrors"
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/morikuni/failure"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	OperatorIn    = "in"     // the attribute is one of the values.
+	OperatorNotIn = "not_in" // the attribute is none of the values.
+)
+
+// attributes maps the well-known attribute names to metadata keys.
+// Other attribute names are used as metadata keys directly.
+var attributes = map[string]string{
+	"tenant": xcontext.TenantKey,
+	"user":   xcontext.UserKey,
+	"region": xcontext.RegionKey,
+}
+
+// Rule targets the requests by an attribute of the request metadata.
+type Rule struct {
+	Attribute string   `mapstructure:"attribute"` // tenant, user, region or any metadata key.
+	Operator  string   `mapstructure:"operator"`  // in/not_in. Default: "in"
+	Values    []string `mapstructure:"values"`
+	Rollout   *float64 `mapstructure:"rollout"` // Percentage of the matched requests to enable. Default: 100
+}
+
+// Flag is the definition of a feature flag.
+//
+// A disabled flag is off for every request. Otherwise the first matched rule
+// decides the rollout percentage, falling back to the rollout of the flag.
+type Flag struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Rollout  *float64 `mapstructure:"rollout"`   // Percentage of the requests to enable. Default: 100
+	BucketBy string   `mapstructure:"bucket_by"` // Attribute to bucket the requests for rollout. Default: "user"
+	Rules    []Rule   `mapstructure:"rules"`
+}
+
+type Option struct {
+	Key string // Config key of the flag definitions. Default: "features"
+}
+
+// Flags evaluates the feature flags defined in config.
+// The definitions are updated when the config reloads.
+type Flags struct {
+	conf config.Config
+	key  string
+
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// New returns the feature flags defined under the option key of conf.
+func New(conf config.Config, o Option) (f *Flags, err error) {
+	if o.Key == "" {
+		o.Key = "features"
+	}
+	f = &Flags{
+		conf: conf,
+		key:  o.Key,
+	}
+	if err = f.load(); err != nil {
+		f = nil
+		return
+	}
+	conf.OnChange(func() {
+		if err := f.load(); err != nil {
+			log.Error().Err(err).Str("key", f.key).Msg("Reload feature flags failed, keep the previous definitions")
+		}
+	})
+	return
+}
+
+func (f *Flags) load() (err error) {
+	flags := make(map[string]Flag)
+	if err = f.conf.UnmarshalKey(f.key, &flags); err != nil {
+		err = failure.Wrap(err,
+			failure.WithCode(liberrors.ErrFeatureFlagInvalid),
+			failure.Context{"key": f.key},
+		)
+		return
+	}
+	for name, flag := range flags {
+		if err = validate(flag); err != nil {
+			err = failure.Wrap(err, failure.Context{"key": f.key, "flag": name})
+			return
+		}
+	}
+
+	f.mu.Lock()
+	f.flags = flags
+	f.mu.Unlock()
+	return
+}
+
+func validate(flag Flag) error {
+	if !validRollout(flag.Rollout) {
+		return failure.New(liberrors.ErrFeatureFlagInvalid, failure.Message("rollout must be between 0 and 100"))
+	}
+	for i := range flag.Rules {
+		switch flag.Rules[i].Operator {
+		case "", OperatorIn, OperatorNotIn:
+		default:
+			return failure.New(liberrors.ErrFeatureFlagInvalid,
+				failure.Message("unknown rule operator"),
+				failure.Context{"operator": flag.Rules[i].Operator},
+			)
+		}
+		if !validRollout(flag.Rules[i].Rollout) {
+			return failure.New(liberrors.ErrFeatureFlagInvalid, failure.Message("rule rollout must be between 0 and 100"))
+		}
+	}
+	return nil
+}
+
+func validRollout(rollout *float64) bool {
+	return rollout == nil || (*rollout >= 0 && *rollout <= 100)
+}
+
+// Enabled reports whether the flag is on for the request metadata in ctx.
+// Unknown flags are off.
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	name = strings.ToLower(name)
+	f.mu.RLock()
+	flag, ok := f.flags[name]
+	f.mu.RUnlock()
+	if !ok || !flag.Enabled {
+		return false
+	}
+
+	md := xcontext.MetadataFromContext(ctx)
+	rollout := flag.Rollout
+	for i := range flag.Rules {
+		if flag.Rules[i].match(md) {
+			rollout = flag.Rules[i].Rollout
+			break
+		}
+	}
+	if rollout == nil {
+		return true
+	}
+
+	bucketBy := flag.BucketBy
+	if bucketBy == "" {
+		bucketBy = "user"
+	}
+	return bucket(name, attribute(md, bucketBy)) < *rollout
+}
+
+func (r Rule) match(md xcontext.Metadata) bool {
+	val := attribute(md, r.Attribute)
+	in := false
+	for _, v := range r.Values {
+		if v == val {
+			in = true
+			break
+		}
+	}
+	if r.Operator == OperatorNotIn {
+		return !in
+	}
+	return in
+}
+
+func attribute(md xcontext.Metadata, name string) string {
+	if key, ok := attributes[strings.ToLower(name)]; ok {
+		name = key
+	}
+	return md.Get(name)
+}
+
+// bucket returns a stable percentage in [0, 100) for the flag and value.
+func bucket(name, value string) float64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + value))
+	return float64(h.Sum32()%10000) / 100
+}
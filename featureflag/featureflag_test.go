@@ -0,0 +1,130 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfans/saaslib/config"
+	"github.com/ipfans/saaslib/xcontext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlags_Enabled(t *testing.T) {
+	conf, err := config.Init(config.WithLocalFile(config.LocalOption{
+		Directory: "./testfixtures/",
+	}))
+	require.NoError(t, err)
+	flags, err := New(conf, Option{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		flag string
+		md   xcontext.Metadata
+		want bool
+	}{
+		{
+			name: "unknown",
+			flag: "unknown",
+			want: false,
+		},
+		{
+			name: "boolean on",
+			flag: "dark-mode",
+			want: true,
+		},
+		{
+			name: "boolean off",
+			flag: "legacy-ui",
+			want: false,
+		},
+		{
+			name: "zero rollout",
+			flag: "nobody",
+			md:   xcontext.Pairs(xcontext.UserKey, "1"),
+			want: false,
+		},
+		{
+			name: "tenant rule matched",
+			flag: "beta",
+			md:   xcontext.Pairs(xcontext.TenantKey, "acme"),
+			want: true,
+		},
+		{
+			name: "not in rule matched",
+			flag: "beta",
+			md:   xcontext.Pairs(xcontext.TenantKey, "initech", xcontext.RegionKey, "us-east"),
+			want: false,
+		},
+		{
+			name: "no rule matched",
+			flag: "beta",
+			md:   xcontext.Pairs(xcontext.TenantKey, "initech", xcontext.RegionKey, "eu-west"),
+			want: false,
+		},
+		{
+			name: "case insensitive name",
+			flag: "Dark-Mode",
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := xcontext.AppendContextMetadata(context.Background(), tt.md)
+			require.Equal(t, tt.want, flags.Enabled(ctx, tt.flag))
+		})
+	}
+}
+
+func TestFlags_Rollout(t *testing.T) {
+	conf, err := config.Init(config.WithLocalFile(config.LocalOption{
+		Directory: "./testfixtures/",
+	}))
+	require.NoError(t, err)
+	flags, err := New(conf, Option{})
+	require.NoError(t, err)
+
+	var enabled int
+	for i := 0; i < 1000; i++ {
+		ctx := xcontext.AppendContextMetadata(context.Background(), xcontext.Pairs(xcontext.UserKey, fmt.Sprint(i)))
+		got := flags.Enabled(ctx, "half")
+		require.Equal(t, got, flags.Enabled(ctx, "half"), "rollout must be stable")
+		if got {
+			enabled++
+		}
+	}
+	require.InDelta(t, 500, enabled, 100)
+}
+
+func TestFlags_Reload(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(fn, []byte("features:\n  new-ui:\n    enabled: false\n"), 0o600))
+
+	conf, err := config.Init(config.WithLocalFile(config.LocalOption{Directory: dir}))
+	require.NoError(t, err)
+	flags, err := New(conf, Option{})
+	require.NoError(t, err)
+	require.False(t, flags.Enabled(context.Background(), "new-ui"))
+
+	require.NoError(t, os.WriteFile(fn, []byte("features:\n  new-ui:\n    enabled: true\n"), 0o600))
+	require.NoError(t, conf.Reload())
+	require.True(t, flags.Enabled(context.Background(), "new-ui"))
+
+	require.NoError(t, os.WriteFile(fn, []byte("features:\n  new-ui:\n    enabled: false\n    rollout: 200\n"), 0o600))
+	require.NoError(t, conf.Reload())
+	require.True(t, flags.Enabled(context.Background(), "new-ui"))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("features:\n  x:\n    rules:\n      - operator: gt\n"), 0o600))
+
+	conf, err := config.Init(config.WithLocalFile(config.LocalOption{Directory: dir}))
+	require.NoError(t, err)
+	_, err = New(conf, Option{Key: "features"})
+	require.Error(t, err)
+}
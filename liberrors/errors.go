@@ -5,4 +5,18 @@ import "github.com/morikuni/failure"
 var (
 	ErrConfigNotEnabled failure.StringCode = "ConfigNotEnabled"
 	ErrConfigReadFailed failure.StringCode = "ConfigReadFailed"
+
+	ErrConfigFileNotFound      failure.StringCode = "ConfigFileNotFound"
+	ErrConfigParseFailed       failure.StringCode = "ConfigParseFailed"
+	ErrConfigRemoteUnreachable failure.StringCode = "ConfigRemoteUnreachable"
+	ErrConfigMergeConflict     failure.StringCode = "ConfigMergeConflict"
+	ErrConfigSignatureInvalid  failure.StringCode = "ConfigSignatureInvalid"
+
+	ErrConfigMigrationFailed  failure.StringCode = "ConfigMigrationFailed"
+	ErrConfigValidationFailed failure.StringCode = "ConfigValidationFailed"
+	ErrConfigConflict         failure.StringCode = "ConfigConflict"
+	ErrConfigPublishFailed    failure.StringCode = "ConfigPublishFailed"
+	ErrConfigKeyNotFound      failure.StringCode = "ConfigKeyNotFound"
+
+	ErrFeatureFlagInvalid failure.StringCode = "FeatureFlagInvalid"
 )
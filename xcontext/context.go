@@ -15,3 +15,16 @@ func MetadataFromContext(ctx context.Context) Metadata {
 func AppendContextMetadata(ctx context.Context, m Metadata) context.Context {
 	return context.WithValue(ctx, metaKey, Join(MetadataFromContext(ctx), m))
 }
+
+// Well-known metadata keys.
+const (
+	TenantKey = "tenant-id" // the tenant ID of the request.
+	UserKey   = "user-id"   // the user ID of the request.
+	RegionKey = "region"    // the region serving the request.
+)
+
+// TenantFromContext returns the tenant ID stored in the context metadata.
+// It returns an empty string if no tenant is present.
+func TenantFromContext(ctx context.Context) string {
+	return MetadataFromContext(ctx).Get(TenantKey)
+}
@@ -94,3 +94,33 @@ func TestMetadataContext(t *testing.T) {
 		})
 	}
 }
+
+func TestTenantFromContext(t *testing.T) {
+	tests := []struct {
+		name string
+		md   Metadata
+		want string
+	}{
+		{
+			name: "empty",
+			md:   nil,
+			want: "",
+		},
+		{
+			name: "tenant",
+			md: Metadata{
+				TenantKey: "acme",
+			},
+			want: "acme",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = AppendContextMetadata(ctx, tt.md)
+			}
+			require.Equal(t, tt.want, TenantFromContext(ctx))
+		})
+	}
+}